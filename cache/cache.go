@@ -1,73 +1,297 @@
 package cache
 
 import (
+	"encoding/json"
+	"github.com/elek/go-utils/kv"
+	"github.com/pkg/errors"
 	"github.com/rs/zerolog/log"
-	"io/ioutil"
 	"os"
 	"path"
 	"strings"
+	"sync"
+	"sync/atomic"
 	"time"
 )
 
+//metadata of the cached values are stored under this prefix of the store
+const metaPrefix = ".meta"
+
 type Cache struct {
-	Prefix string
+	//first field to be 64-bit aligned for the atomic operations
+	counters counters
+	Prefix   string
+	//Store keeps the cached values. Without Store, the values are saved to the directory defined by the
+	//<PREFIX>_CACHE environment variable or to ~/.cache/<prefix>, readable only by the owner. The values cached by the
+	//earlier versions (without metadata) in this directory are migrated at the first use.
+	Store kv.KV
+	//MaxSize is the maximum total size of the cached values in bytes (0: unlimited). The least recently used entries
+	//are evicted after the writes which exceed the limit.
+	MaxSize int64
+	//MaxEntries is the maximum number of the cached entries (0: unlimited).
+	MaxEntries int
+	//KeyMapper converts the keys to the keys of the store (SafeKey if nil).
+	KeyMapper KeyMapper
+	//MemoryEntries is the maximum number of the entries kept in the memory in front of the store (0: no memory tier).
+	MemoryEntries int
+	//MemorySize is the maximum total size of the values kept in the memory in bytes (0: unlimited).
+	MemorySize int64
+	//DisableDisk turns off the store, the values are cached only in the memory (up to 1000 entries if MemoryEntries is
+	//not set).
+	DisableDisk bool
+	//guards Store, defaultStore and memory
+	lock sync.Mutex
+	//true if the Store is the default directory store
+	defaultStore bool
+	//memory tier, created at the first use
+	memory *memoryTier
+	//only one getter is called for the same key at the same time
+	flight flightGroup
+	//guards usage
+	usageLock sync.Mutex
+	//tracked entries if there are limits, loaded at the first write
+	usage *usage
+}
+
+//Entry is the metadata of a cached value.
+type Entry struct {
+	Key     string    `json:"key"`
+	Created time.Time `json:"created"`
+	Size    int64     `json:"size"`
+	//Accessed is the time of the last read, if MaxSize or MaxEntries is set
+	Accessed time.Time `json:"accessed"`
+	//Error is the message of the failed getter call if the entry is a cached error
+	Error string `json:"error,omitempty"`
+	//Tags can be used to invalidate related entries together (eg. project:HDDS)
+	Tags []string `json:"tags,omitempty"`
+}
+
+//Age returns the time elapsed since the value was cached.
+func (e Entry) Age() time.Duration {
+	return time.Since(e.Created)
 }
 
 type Getter func() ([]byte, error)
 
-type IsCacheValid func(string) (bool, error)
+//IsCacheValid decides if the cached value can be returned instead of calling the Getter.
+type IsCacheValid func(entry Entry) (bool, error)
+
+//CreateCache creates a cache which saves the values to the store.
+func CreateCache(store kv.KV) *Cache {
+	return &Cache{
+		Store: store,
+	}
+}
 
 func (cache *Cache) ForceGet(getter Getter, key string) ([]byte, error) {
-	return cache.Get(getter, key, func(s string) (bool, error) {
+	return cache.Get(getter, key, func(entry Entry) (bool, error) {
 		return false, nil
 	})
 }
 
 func (cache *Cache) Get3min(getter Getter, key string) ([]byte, error) {
-	return cache.Get(getter, key, timeout3Minute)
+	return cache.GetWithPolicy(getter, key, Policy{TTL: 3 * time.Minute})
 }
 
-func timeout3Minute(cacheFile string) (bool, error) {
-	if stat, err := os.Stat(cacheFile); !os.IsNotExist(err) {
-		if stat.ModTime().Add(3 * time.Minute).After(time.Now()) {
-			return true, nil
+//store returns the configured store or the default directory store. Returns nil if there is no place to cache or the
+//disk tier is disabled.
+func (cache *Cache) store() kv.KV {
+	cache.lock.Lock()
+	defer cache.lock.Unlock()
+	if cache.DisableDisk {
+		return nil
+	}
+	if cache.Store != nil {
+		return cache.Store
+	}
+	dir := os.Getenv(strings.ToUpper(cache.Prefix) + "_CACHE")
+	if dir == "" {
+		home, err := os.UserHomeDir()
+		if err != nil {
+			return nil
 		}
+		dir = path.Join(home, ".cache", strings.ToLower(cache.Prefix))
 	}
-	return false, nil
+	_ = os.MkdirAll(dir, 0700)
+	//cached responses may contain private data
+	store := &kv.DirKV{Path: dir, FileMode: 0600, DirMode: 0700}
+	cache.migrate(store)
+	cache.Store = store
+	cache.defaultStore = true
+	return cache.Store
 }
 
-func (cache *Cache) Get(getter Getter, key string, cacheValidator IsCacheValid) ([]byte, error) {
-	oghCache := os.Getenv(strings.ToUpper(cache.Prefix) + "_CACHE")
+//memoryTier returns the memory tier or nil if it's not enabled
+func (cache *Cache) memoryTier() *memoryTier {
+	cache.lock.Lock()
+	defer cache.lock.Unlock()
+	if cache.memory == nil && (cache.MemoryEntries > 0 || cache.DisableDisk) {
+		maxEntries := cache.MemoryEntries
+		if maxEntries <= 0 {
+			maxEntries = defaultMemoryEntries
+		}
+		cache.memory = newMemoryTier(maxEntries, cache.MemorySize)
+	}
+	return cache.memory
+}
 
-	if oghCache == "" {
-		home, err := os.UserHomeDir()
-		if err == nil {
-			oghCache = path.Join(home, ".cache", strings.ToLower(cache.Prefix))
+//enabled returns false if there is neither store nor memory tier to cache the values
+func (cache *Cache) enabled(store kv.KV) bool {
+	return store != nil || cache.memoryTier() != nil
+}
+
+//remember saves the item to the memory tier (if enabled)
+func (cache *Cache) remember(item memoryItem) {
+	memory := cache.memoryTier()
+	if memory == nil {
+		return
+	}
+	evicted := memory.put(item)
+	//without disk, the entries evicted from the memory are lost
+	if cache.DisableDisk && evicted > 0 {
+		atomic.AddInt64(&cache.counters.evictions, int64(evicted))
+	}
+}
+
+//entry returns the metadata of a cached value or error. Values without metadata are not used.
+func (cache *Cache) entry(store kv.KV, key string) (Entry, bool) {
+	if memory := cache.memoryTier(); memory != nil {
+		if item, found := memory.get(key); found {
+			return item.entry, true
 		}
 	}
-	cacheFile := ""
-	if oghCache != "" {
-		cacheFile = path.Join(oghCache, key)
+	entry := Entry{}
+	if store == nil {
+		return entry, false
+	}
+	metaKey := cache.metaKey(key)
+	if !store.Contains(metaKey) {
+		return entry, false
+	}
+	content, err := store.Get(metaKey)
+	if err == nil {
+		err = json.Unmarshal(content, &entry)
+	}
+	if err != nil {
+		log.Warn().Err(err).Msgf("Metadata of the cached value '%s' is unreadable", key)
+		return entry, false
+	}
+	if entry.Error == "" && !store.Contains(cache.valueKey(key)) {
+		return entry, false
 	}
+	if entry.Error != "" {
+		cache.remember(memoryItem{entry: entry})
+	}
+	return entry, true
+}
+
+func (cache *Cache) put(store kv.KV, key string, value []byte, tags []string) error {
+	entry := Entry{
+		Key:     key,
+		Created: time.Now(),
+		Size:    int64(len(value)),
+		Tags:    tags,
+	}
+	cache.remember(memoryItem{entry: entry, value: value})
+	if store == nil {
+		return nil
+	}
+	err := store.Put(cache.valueKey(key), value)
+	if err != nil {
+		return err
+	}
+	atomic.AddInt64(&cache.counters.bytesWritten, int64(len(value)))
+	err = cache.putEntry(store, entry)
+	if err != nil {
+		return err
+	}
+	return cache.tracked(store, entry)
+}
+
+//putError saves the failure of the getter instead of the value
+func (cache *Cache) putError(store kv.KV, key string, failure error, tags []string) error {
+	entry := Entry{
+		Key:     key,
+		Created: time.Now(),
+		Error:   failure.Error(),
+		Tags:    tags,
+	}
+	cache.remember(memoryItem{entry: entry})
+	if store == nil {
+		return nil
+	}
+	err := store.Delete(cache.valueKey(key))
+	if err != nil {
+		return err
+	}
+	err = cache.putEntry(store, entry)
+	if err != nil {
+		return err
+	}
+	return cache.tracked(store, entry)
+}
 
-	if cacheFile != "" {
-		_ = os.MkdirAll(oghCache, 0700)
+func (cache *Cache) putEntry(store kv.KV, entry Entry) error {
+	content, err := json.Marshal(entry)
+	if err != nil {
+		return err
+	}
+	return store.Put(cache.metaKey(entry.Key), content)
+}
 
-		valid, err := cacheValidator(cacheFile)
+//read returns the cached value of the entry. Fails if the value is removed since the entry is read, which should be
+//handled as a miss.
+func (cache *Cache) read(store kv.KV, entry Entry) ([]byte, error) {
+	memory := cache.memoryTier()
+	if memory != nil {
+		if item, found := memory.get(entry.Key); found && item.entry.Error == "" {
+			log.Debug().Msgf("'%s' is read from the cache", entry.Key)
+			cache.touch(store, entry)
+			atomic.AddInt64(&cache.counters.bytesRead, int64(len(item.value)))
+			return item.value, nil
+		}
+	}
+	if store == nil {
+		return nil, errors.New("Cached value of '" + entry.Key + "' is evicted from the memory")
+	}
+	value, err := store.Get(cache.valueKey(entry.Key))
+	if err != nil {
+		return nil, err
+	}
+	log.Debug().Msgf("'%s' is read from the cache", entry.Key)
+	cache.touch(store, entry)
+	atomic.AddInt64(&cache.counters.bytesRead, int64(len(value)))
+	//the entry keeps the original creation time, the TTL is the same in both tiers
+	cache.remember(memoryItem{entry: entry, value: value})
+	return value, nil
+}
+
+func (cache *Cache) Get(getter Getter, key string, cacheValidator IsCacheValid) ([]byte, error) {
+	store := cache.store()
+	enabled := cache.enabled(store)
+	if entry, found := cache.entry(store, key); found && entry.Error == "" {
+		valid, err := cacheValidator(entry)
 		if err != nil {
-			println("Couldn't validate cache file " + cacheFile + " " + err.Error())
+			log.Warn().Err(err).Msgf("Couldn't validate the cached value of '%s'", key)
 		}
 		if err == nil && valid {
-			log.Debug().Msgf("'%s' is read from the cache", key)
-			return ioutil.ReadFile(cacheFile)
+			value, err := cache.read(store, entry)
+			if err == nil {
+				atomic.AddInt64(&cache.counters.hits, 1)
+				return value, nil
+			}
+			//the value can be evicted or deleted after the metadata is read
+			log.Debug().Err(err).Msgf("Cached value of '%s' is unreadable, calling the getter", key)
 		}
 	}
-	result, err := getter()
-	if err == nil && cacheFile != "" {
-		err = ioutil.WriteFile(cacheFile, result, 0600)
-		if err != nil {
-			return nil, err
+	atomic.AddInt64(&cache.counters.misses, 1)
+	return cache.flight.do(key, func() ([]byte, error) {
+		result, err := cache.call(getter)
+		if err == nil && enabled {
+			err = cache.put(store, key, result, nil)
+			if err != nil {
+				return nil, err
+			}
 		}
-	}
-	return result, err
+		return result, err
+	})
 }
@@ -0,0 +1,635 @@
+package cache
+
+import (
+	"github.com/elek/go-utils/kv"
+	"github.com/pkg/errors"
+	"github.com/stretchr/testify/assert"
+	"io/ioutil"
+	"os"
+	"path"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func getStores() []kv.KV {
+	_ = os.RemoveAll("/tmp/cachetest")
+	return []kv.KV{
+		&kv.DirKV{Path: "/tmp/cachetest"},
+		kv.CreateMemoryKV(),
+	}
+}
+
+func TestGet3min(t *testing.T) {
+	for _, store := range getStores() {
+		cache := CreateCache(store)
+		calls := 0
+		getter := func() ([]byte, error) {
+			calls++
+			return []byte("value" + strconv.Itoa(calls)), nil
+		}
+		for i := 0; i < 3; i++ {
+			value, err := cache.Get3min(getter, "key1")
+			assert.Nil(t, err)
+			assert.Equal(t, []byte("value1"), value)
+		}
+		assert.Equal(t, 1, calls)
+
+		value, err := cache.ForceGet(getter, "key1")
+		assert.Nil(t, err)
+		assert.Equal(t, []byte("value2"), value)
+	}
+}
+
+func TestDefaultStore(t *testing.T) {
+	_ = os.RemoveAll("/tmp/cachetest")
+	_ = os.Setenv("CACHETEST_CACHE", "/tmp/cachetest")
+	defer os.Unsetenv("CACHETEST_CACHE")
+	cache := &Cache{Prefix: "cachetest"}
+	_, err := cache.Get3min(func() ([]byte, error) {
+		return []byte("value1"), nil
+	}, "key1")
+	assert.Nil(t, err)
+
+	content, err := ioutil.ReadFile("/tmp/cachetest/key1")
+	assert.Nil(t, err)
+	assert.Equal(t, []byte("value1"), content)
+
+	for file, mode := range map[string]os.FileMode{
+		"/tmp/cachetest":            os.ModeDir | 0700,
+		"/tmp/cachetest/key1":       0600,
+		"/tmp/cachetest/.meta":      os.ModeDir | 0700,
+		"/tmp/cachetest/.meta/key1": 0600,
+	} {
+		stat, err := os.Stat(file)
+		assert.Nil(t, err)
+		assert.Equal(t, mode, stat.Mode(), file)
+	}
+}
+
+func TestMigrate(t *testing.T) {
+	_ = os.RemoveAll("/tmp/cachetest")
+	_ = os.Setenv("CACHETEST_CACHE", "/tmp/cachetest")
+	defer os.Unsetenv("CACHETEST_CACHE")
+	//files of the earlier versions, without metadata
+	_ = os.MkdirAll("/tmp/cachetest/issues", 0755)
+	assert.Nil(t, ioutil.WriteFile("/tmp/cachetest/key1", []byte("old1"), 0644))
+	assert.Nil(t, ioutil.WriteFile("/tmp/cachetest/issues/HDDS-1", []byte("old2"), 0644))
+	assert.Nil(t, ioutil.WriteFile("/tmp/cachetest/expired", []byte("old3"), 0644))
+	hourAgo := time.Now().Add(-time.Hour)
+	assert.Nil(t, os.Chtimes("/tmp/cachetest/expired", hourAgo, hourAgo))
+
+	cache := &Cache{Prefix: "cachetest"}
+	getter := func() ([]byte, error) {
+		return []byte("new"), nil
+	}
+	for key, expected := range map[string]string{"key1": "old1", "issues/HDDS-1": "old2", "expired": "new"} {
+		value, err := cache.Get3min(getter, key)
+		assert.Nil(t, err)
+		assert.Equal(t, expected, string(value), key)
+	}
+
+	keys, err := cache.Keys()
+	assert.Nil(t, err)
+	assert.Equal(t, []string{"expired", "issues/HDDS-1", "key1"}, keys)
+	_, err = os.Stat("/tmp/cachetest/issues/HDDS-1")
+	assert.True(t, os.IsNotExist(err))
+	stat, err := os.Stat("/tmp/cachetest/key1")
+	assert.Nil(t, err)
+	assert.Equal(t, os.FileMode(0600), stat.Mode())
+
+	assert.Nil(t, cache.Purge())
+	files, err := ioutil.ReadDir("/tmp/cachetest")
+	assert.Nil(t, err)
+	for _, file := range files {
+		assert.Equal(t, ".meta", file.Name())
+	}
+}
+
+func TestPolicy(t *testing.T) {
+	cache := CreateCache(kv.CreateMemoryKV())
+	calls := 0
+	var failure error
+	getter := func() ([]byte, error) {
+		calls++
+		if failure != nil {
+			return nil, failure
+		}
+		return []byte("value" + strconv.Itoa(calls)), nil
+	}
+	policy := Policy{TTL: 20 * time.Millisecond, MaxStale: time.Minute, ErrorTTL: time.Minute}
+
+	_, err := cache.GetWithPolicy(getter, "key1", policy)
+	assert.Nil(t, err)
+	time.Sleep(30 * time.Millisecond)
+
+	//expired, but the stale value is returned if the getter fails
+	failure = errors.New("service is unavailable")
+	value, err := cache.GetWithPolicy(getter, "key1", policy)
+	assert.Nil(t, err)
+	assert.Equal(t, []byte("value1"), value)
+	assert.Equal(t, 2, calls)
+
+	//errors are cached
+	_, err = cache.GetWithPolicy(getter, "key2", policy)
+	assert.NotNil(t, err)
+	_, err = cache.GetWithPolicy(getter, "key2", policy)
+	assert.NotNil(t, err)
+	assert.Equal(t, 3, calls)
+}
+
+func TestRefreshAhead(t *testing.T) {
+	cache := CreateCache(kv.CreateMemoryKV())
+	calls := int32(0)
+	getter := func() ([]byte, error) {
+		return []byte("value" + strconv.Itoa(int(atomic.AddInt32(&calls, 1)))), nil
+	}
+	policy := Policy{TTL: time.Second, RefreshAhead: 900 * time.Millisecond}
+
+	value, err := cache.GetWithPolicy(getter, "key1", policy)
+	assert.Nil(t, err)
+	assert.Equal(t, []byte("value1"), value)
+
+	//fresh and not close to the expiration
+	value, err = cache.GetWithPolicy(getter, "key1", policy)
+	assert.Nil(t, err)
+	assert.Equal(t, []byte("value1"), value)
+	assert.Equal(t, int32(1), atomic.LoadInt32(&calls))
+
+	//close to the expiration: the cached value is returned and refreshed in the background
+	time.Sleep(150 * time.Millisecond)
+	value, err = cache.GetWithPolicy(getter, "key1", policy)
+	assert.Nil(t, err)
+	assert.Equal(t, []byte("value1"), value)
+	for i := 0; i < 100 && atomic.LoadInt32(&calls) < 2; i++ {
+		time.Sleep(10 * time.Millisecond)
+	}
+	assert.Equal(t, int32(2), atomic.LoadInt32(&calls))
+
+	//the refreshed value is fresh again
+	for i := 0; i < 100; i++ {
+		if entry, found := cache.entry(cache.store(), "key1"); found && entry.Age() < 100*time.Millisecond {
+			break
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	value, err = cache.GetWithPolicy(getter, "key1", policy)
+	assert.Nil(t, err)
+	assert.Equal(t, []byte("value2"), value)
+	assert.Equal(t, int32(2), atomic.LoadInt32(&calls))
+}
+
+//vanishingKV deletes the key right after the existence check, like a concurrent eviction
+type vanishingKV struct {
+	kv.KV
+	vanish string
+}
+
+func (v *vanishingKV) Contains(key string) bool {
+	found := v.KV.Contains(key)
+	if key == v.vanish {
+		_ = v.KV.Delete(key)
+	}
+	return found
+}
+
+func TestValueRemovedAfterEntry(t *testing.T) {
+	calls := 0
+	getter := func() ([]byte, error) {
+		calls++
+		return []byte("value" + strconv.Itoa(calls)), nil
+	}
+	store := &vanishingKV{KV: kv.CreateMemoryKV()}
+	cache := CreateCache(store)
+	_, err := cache.Get3min(getter, "key1")
+	assert.Nil(t, err)
+
+	store.vanish = cache.valueKey("key1")
+	value, err := cache.Get3min(getter, "key1")
+	assert.Nil(t, err)
+	assert.Equal(t, []byte("value2"), value)
+
+	value, err = cache.Get(getter, "key1", func(entry Entry) (bool, error) {
+		return true, nil
+	})
+	assert.Nil(t, err)
+	assert.Equal(t, []byte("value3"), value)
+	assert.Equal(t, 3, calls)
+
+	store.vanish = ""
+	value, err = cache.Get3min(getter, "key1")
+	assert.Nil(t, err)
+	assert.Equal(t, []byte("value3"), value)
+	assert.Equal(t, int64(1), cache.Stats().Hits)
+}
+
+func TestConcurrentMiss(t *testing.T) {
+	for _, store := range getStores() {
+		cache := CreateCache(store)
+		calls := int32(0)
+		getter := func() ([]byte, error) {
+			atomic.AddInt32(&calls, 1)
+			time.Sleep(50 * time.Millisecond)
+			return []byte("value"), nil
+		}
+		wg := sync.WaitGroup{}
+		results := make([][]byte, 100)
+		for i := 0; i < len(results); i++ {
+			wg.Add(1)
+			go func(i int) {
+				defer wg.Done()
+				value, err := cache.Get3min(getter, "key1")
+				assert.Nil(t, err)
+				results[i] = value
+			}(i)
+		}
+		wg.Wait()
+		assert.Equal(t, int32(1), calls)
+		for _, result := range results {
+			assert.Equal(t, []byte("value"), result)
+		}
+	}
+}
+
+func TestFlightPanic(t *testing.T) {
+	group := flightGroup{}
+	release := make(chan struct{})
+	leader := make(chan interface{})
+	go func() {
+		defer func() {
+			leader <- recover()
+		}()
+		_, _ = group.do("key1", func() ([]byte, error) {
+			<-release
+			panic("getter is failed")
+		})
+	}()
+	for !group.running("key1") {
+		time.Sleep(time.Millisecond)
+	}
+
+	wg := sync.WaitGroup{}
+	errs := make([]error, 2)
+	values := make([][]byte, 2)
+	for i := range errs {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			values[i], errs[i] = group.do("key1", func() ([]byte, error) {
+				return []byte("second call"), nil
+			})
+		}(i)
+	}
+	//the waiters are blocked on the running call
+	time.Sleep(50 * time.Millisecond)
+	close(release)
+
+	assert.Equal(t, "getter is failed", <-leader)
+	wg.Wait()
+	for i := range errs {
+		assert.NotNil(t, errs[i])
+		assert.Contains(t, errs[i].Error(), "getter is failed")
+		assert.Nil(t, values[i])
+	}
+	assert.False(t, group.running("key1"))
+}
+
+func TestConcurrentWrites(t *testing.T) {
+	store := getStores()[0]
+	cache := CreateCache(store)
+	wg := sync.WaitGroup{}
+	for i := 0; i < 50; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			_, err := cache.ForceGet(func() ([]byte, error) {
+				return []byte(strings.Repeat(strconv.Itoa(i%10), 10000)), nil
+			}, "key"+strconv.Itoa(i%5))
+			assert.Nil(t, err)
+		}(i)
+	}
+	wg.Wait()
+
+	for i := 0; i < 5; i++ {
+		value, err := cache.Get3min(func() ([]byte, error) {
+			return nil, errors.New("value should be cached")
+		}, "key"+strconv.Itoa(i))
+		assert.Nil(t, err)
+		assert.Equal(t, 10000, len(value))
+		assert.Equal(t, strings.Repeat(string(value[0]), 10000), string(value))
+	}
+	files, err := ioutil.ReadDir("/tmp/cachetest")
+	assert.Nil(t, err)
+	for _, file := range files {
+		assert.False(t, strings.Contains(path.Base(file.Name()), ".kvtmp"), "temporary file is left: "+file.Name())
+	}
+}
+
+func TestEviction(t *testing.T) {
+	for _, store := range getStores() {
+		cache := CreateCache(store)
+		cache.MaxEntries = 2
+		getter := func() ([]byte, error) {
+			return []byte("value"), nil
+		}
+		_, err := cache.Get3min(getter, "key1")
+		assert.Nil(t, err)
+		_, err = cache.Get3min(getter, "key2")
+		assert.Nil(t, err)
+
+		//key1 is used after key2, therefore key2 is the least recently used one
+		_, err = cache.Get3min(getter, "key1")
+		assert.Nil(t, err)
+		_, err = cache.Get3min(getter, "key3")
+		assert.Nil(t, err)
+
+		assert.True(t, store.Contains("key1"))
+		assert.False(t, store.Contains("key2"))
+		assert.True(t, store.Contains("key3"))
+
+		cache.MaxEntries = 0
+		cache.MaxSize = 12
+		_, err = cache.Get3min(func() ([]byte, error) {
+			return []byte("long value"), nil
+		}, "key4")
+		assert.Nil(t, err)
+		assert.False(t, store.Contains("key1"))
+		assert.False(t, store.Contains("key3"))
+		assert.True(t, store.Contains("key4"))
+
+		//values larger than the limit are returned, but not kept
+		value, err := cache.Get3min(func() ([]byte, error) {
+			return []byte("value larger than the limit"), nil
+		}, "key5")
+		assert.Nil(t, err)
+		assert.Equal(t, []byte("value larger than the limit"), value)
+		assert.False(t, store.Contains("key4"))
+		assert.False(t, store.Contains("key5"))
+		keys, err := cache.Keys()
+		assert.Nil(t, err)
+		assert.Empty(t, keys)
+	}
+}
+
+//countingKV counts the writes
+type countingKV struct {
+	kv.KV
+	puts int
+}
+
+func (c *countingKV) Put(key string, value []byte) error {
+	c.puts++
+	return c.KV.Put(key, value)
+}
+
+func TestAccessTimeWithoutLimits(t *testing.T) {
+	store := &countingKV{KV: kv.CreateMemoryKV()}
+	cache := CreateCache(store)
+	getter := func() ([]byte, error) {
+		return []byte("value"), nil
+	}
+	_, err := cache.Get3min(getter, "key1")
+	assert.Nil(t, err)
+	//value and metadata
+	assert.Equal(t, 2, store.puts)
+
+	time.Sleep(accessResolution + 10*time.Millisecond)
+	_, err = cache.Get3min(getter, "key1")
+	assert.Nil(t, err)
+	assert.Equal(t, 2, store.puts)
+
+	//with limits the access time is saved
+	cache.MaxEntries = 10
+	_, err = cache.Get3min(getter, "key1")
+	assert.Nil(t, err)
+	assert.Equal(t, 3, store.puts)
+}
+
+func TestPruneAndPurge(t *testing.T) {
+	for _, store := range getStores() {
+		cache := CreateCache(store)
+		for i := 0; i < 5; i++ {
+			_, err := cache.Get3min(func() ([]byte, error) {
+				return []byte("value"), nil
+			}, "key"+strconv.Itoa(i))
+			assert.Nil(t, err)
+		}
+
+		cache.MaxEntries = 3
+		assert.Nil(t, cache.Prune())
+		entries, err := cache.entries(store)
+		assert.Nil(t, err)
+		assert.Equal(t, 3, len(entries))
+		assert.False(t, store.Contains("key0"))
+		assert.True(t, store.Contains("key4"))
+
+		assert.Nil(t, cache.Purge())
+		entries, err = cache.entries(store)
+		assert.Nil(t, err)
+		assert.Equal(t, 0, len(entries))
+		assert.False(t, store.Contains("key4"))
+	}
+}
+
+func TestMemoryTier(t *testing.T) {
+	for _, store := range getStores() {
+		cache := CreateCache(store)
+		cache.MemoryEntries = 2
+		getter := func() ([]byte, error) {
+			return []byte("value"), nil
+		}
+		_, err := cache.Get3min(getter, "key1")
+		assert.Nil(t, err)
+
+		//served from the memory, even if the store is changed
+		assert.Nil(t, store.Put("key1", []byte("changed")))
+		value, err := cache.Get3min(getter, "key1")
+		assert.Nil(t, err)
+		assert.Equal(t, []byte("value"), value)
+
+		//key1 is evicted from the memory, read again from the store
+		_, err = cache.Get3min(getter, "key2")
+		assert.Nil(t, err)
+		_, err = cache.Get3min(getter, "key3")
+		assert.Nil(t, err)
+		value, err = cache.Get3min(getter, "key1")
+		assert.Nil(t, err)
+		assert.Equal(t, []byte("changed"), value)
+		assert.Equal(t, int64(0), cache.Stats().Evictions)
+	}
+}
+
+func TestDisableDisk(t *testing.T) {
+	store := kv.CreateMemoryKV()
+	cache := CreateCache(store)
+	cache.DisableDisk = true
+	cache.MemoryEntries = 2
+	calls := 0
+	getter := func() ([]byte, error) {
+		calls++
+		return []byte("value"), nil
+	}
+	for _, key := range []string{"key1", "key1", "key2", "key3", "key1"} {
+		value, err := cache.Get3min(getter, key)
+		assert.Nil(t, err)
+		assert.Equal(t, []byte("value"), value)
+	}
+	assert.Equal(t, 4, calls)
+	assert.Equal(t, int64(2), cache.Stats().Evictions)
+
+	keys, err := store.List("")
+	assert.Nil(t, err)
+	assert.Equal(t, 0, len(keys))
+	keys, err = cache.Keys()
+	assert.Nil(t, err)
+	assert.Equal(t, []string{"key1", "key3"}, keys)
+
+	//errors are cached in the memory with their own TTL
+	failing := func() ([]byte, error) {
+		calls++
+		return nil, errors.New("Failed")
+	}
+	for i := 0; i < 2; i++ {
+		_, err = cache.GetWithPolicy(failing, "key4", Policy{TTL: time.Minute, ErrorTTL: time.Minute})
+		assert.NotNil(t, err)
+	}
+	assert.Equal(t, 5, calls)
+
+	assert.Nil(t, cache.Purge())
+	keys, err = cache.Keys()
+	assert.Nil(t, err)
+	assert.Equal(t, 0, len(keys))
+}
+
+func TestInvalidate(t *testing.T) {
+	for _, store := range getStores() {
+		cache := CreateCache(store)
+		cache.MemoryEntries = 10
+		put := func(key string, tags ...string) {
+			_, err := cache.GetWithPolicy(func() ([]byte, error) {
+				return []byte("value"), nil
+			}, key, Policy{TTL: time.Minute, Tags: tags})
+			assert.Nil(t, err)
+		}
+		keys := func() []string {
+			result, err := cache.Keys()
+			assert.Nil(t, err)
+			return result
+		}
+		put("search:HDDS:open", "project:HDDS")
+		put("search:HDDS:closed", "project:HDDS")
+		put("search:RATIS:open", "project:RATIS")
+		put("pr:apache/ozone:1", "repo:apache/ozone")
+
+		removed, err := cache.InvalidateTag("project:HDDS")
+		assert.Nil(t, err)
+		assert.Equal(t, 2, removed)
+		assert.Equal(t, []string{"pr:apache/ozone:1", "search:RATIS:open"}, keys())
+
+		removed, err = cache.InvalidatePrefix("search:")
+		assert.Nil(t, err)
+		assert.Equal(t, 1, removed)
+		assert.Equal(t, []string{"pr:apache/ozone:1"}, keys())
+
+		time.Sleep(20 * time.Millisecond)
+		put("pr:apache/ozone:2")
+		removed, err = cache.InvalidateOlderThan(10 * time.Millisecond)
+		assert.Nil(t, err)
+		assert.Equal(t, 1, removed)
+		assert.Equal(t, []string{"pr:apache/ozone:2"}, keys())
+
+		//removed from the memory tier too
+		calls := 0
+		_, err = cache.Get3min(func() ([]byte, error) {
+			calls++
+			return []byte("value"), nil
+		}, "search:HDDS:open")
+		assert.Nil(t, err)
+		assert.Equal(t, 1, calls)
+	}
+}
+
+func TestSafeKey(t *testing.T) {
+	assert.Equal(t, "issues-123.json", SafeKey("issues-123.json"))
+
+	key := SafeKey("https://api.github.com/repos/apache/ozone/pulls?state=closed&page=2")
+	assert.True(t, strings.HasPrefix(key, "https_api.github.com_repos_apache_ozone_pulls_state"), key)
+	assert.NotEqual(t, key, SafeKey("https://api.github.com/repos/apache/ozone/pulls?state=closed&page=3"))
+
+	assert.False(t, strings.HasPrefix(SafeKey("../passwd"), "."))
+	assert.True(t, len(SafeKey(strings.Repeat("x", 1000))) < 100)
+}
+
+func TestKeys(t *testing.T) {
+	store := kv.CreateMemoryKV()
+	github := CreateCache(store)
+	github.Prefix = "github"
+	jira := CreateCache(store)
+	jira.Prefix = "jira"
+
+	keys := []string{"https://api.github.com/repos/apache/ozone?x=1", "simple", "project = HDDS AND status = Open"}
+	for _, key := range keys {
+		_, err := github.Get3min(func() ([]byte, error) {
+			return []byte(key), nil
+		}, key)
+		assert.Nil(t, err)
+	}
+	_, err := jira.Get3min(func() ([]byte, error) {
+		return []byte("value"), nil
+	}, "simple")
+	assert.Nil(t, err)
+
+	result, err := github.Keys()
+	assert.Nil(t, err)
+	sort.Strings(keys)
+	assert.Equal(t, keys, result)
+
+	result, err = jira.Keys()
+	assert.Nil(t, err)
+	assert.Equal(t, []string{"simple"}, result)
+
+	value, err := github.Get3min(func() ([]byte, error) {
+		return nil, errors.New("value should be cached")
+	}, keys[0])
+	assert.Nil(t, err)
+	assert.Equal(t, []byte(keys[0]), value)
+
+	err = store.IterateAll(func(key string) error {
+		assert.True(t, strings.HasPrefix(key, "github/") || strings.HasPrefix(key, "jira/"), key)
+		//the URLs don't create sub-directories
+		assert.Equal(t, 2, len(strings.Split(strings.Replace(key, "/.meta/", "/", 1), "/")), key)
+		return nil
+	})
+	assert.Nil(t, err)
+}
+
+func TestStats(t *testing.T) {
+	cache := CreateCache(kv.CreateMemoryKV())
+	cache.Prefix = "test"
+	for i := 0; i < 3; i++ {
+		_, err := cache.Get3min(func() ([]byte, error) {
+			return []byte("value"), nil
+		}, "key1")
+		assert.Nil(t, err)
+	}
+	_, err := cache.ForceGet(func() ([]byte, error) {
+		return nil, errors.New("failure")
+	}, "key2")
+	assert.NotNil(t, err)
+
+	stats := cache.Stats()
+	assert.Equal(t, int64(2), stats.Hits)
+	assert.Equal(t, int64(2), stats.Misses)
+	assert.Equal(t, int64(2), stats.GetterCalls)
+	assert.Equal(t, int64(1), stats.GetterErrors)
+	assert.Equal(t, int64(5), stats.BytesWritten)
+	assert.Equal(t, int64(10), stats.BytesRead)
+
+	output := strings.Builder{}
+	assert.Nil(t, WritePrometheus(&output, cache))
+	assert.Contains(t, output.String(), "# TYPE cache_hits_total counter\ncache_hits_total{cache=\"test\"} 2\n")
+}
@@ -0,0 +1,228 @@
+package cache
+
+import (
+	"encoding/json"
+	"github.com/elek/go-utils/kv"
+	"github.com/rs/zerolog/log"
+	"sort"
+	"sync/atomic"
+	"time"
+)
+
+//access time of the entries is updated only if the previous one is older than this
+const accessResolution = time.Second
+
+//usage tracks the entries of the store to check the limits without iterating over the metadata at every write
+type usage struct {
+	entries map[string]Entry
+	size    int64
+}
+
+func (u *usage) add(entry Entry) {
+	u.remove(entry.Key)
+	u.entries[entry.Key] = entry
+	u.size += entry.Size
+}
+
+func (u *usage) remove(key string) {
+	if old, found := u.entries[key]; found {
+		u.size -= old.Size
+		delete(u.entries, key)
+	}
+}
+
+//lastUsed returns the time of the last read (or the write if it's not read yet)
+func (e Entry) lastUsed() time.Time {
+	if e.Accessed.After(e.Created) {
+		return e.Accessed
+	}
+	return e.Created
+}
+
+func (cache *Cache) limited() bool {
+	return cache.MaxSize > 0 || cache.MaxEntries > 0
+}
+
+//entries returns the metadata of all the cached values and errors
+func (cache *Cache) entries(store kv.KV) ([]Entry, error) {
+	if store == nil {
+		if memory := cache.memoryTier(); memory != nil {
+			return memory.entries(), nil
+		}
+		return []Entry{}, nil
+	}
+	result := make([]Entry, 0)
+	metaRoot := cache.metaRoot()
+	if keys, _ := store.List(metaRoot); len(keys) == 0 {
+		return result, nil
+	}
+	err := store.IterateSubTree(metaRoot, func(metaKey string) error {
+		content, err := store.Get(metaKey)
+		if err != nil {
+			return err
+		}
+		entry := Entry{}
+		if json.Unmarshal(content, &entry) != nil {
+			log.Warn().Msgf("Cache metadata %s is unreadable", metaKey)
+			return nil
+		}
+		result = append(result, entry)
+		return nil
+	})
+	return result, err
+}
+
+//loadUsage reads the metadata of all the entries. Should be called with the usageLock.
+func (cache *Cache) loadUsage(store kv.KV) error {
+	entries, err := cache.entries(store)
+	if err != nil {
+		return err
+	}
+	cache.usage = &usage{entries: make(map[string]Entry)}
+	for _, entry := range entries {
+		cache.usage.add(entry)
+	}
+	return nil
+}
+
+//tracked updates the usage after a write and evicts the least recently used entries if the limits are exceeded
+func (cache *Cache) tracked(store kv.KV, entry Entry) error {
+	if !cache.limited() || store == nil {
+		return nil
+	}
+	cache.usageLock.Lock()
+	defer cache.usageLock.Unlock()
+	if cache.usage == nil {
+		err := cache.loadUsage(store)
+		if err != nil {
+			return err
+		}
+	}
+	cache.usage.add(entry)
+	return cache.evict(store, entry.Key)
+}
+
+//evict removes the least recently used entries until the usage is under the limits. The entry of the keep key (the
+//last written one) is evicted only if the limits are still exceeded after evicting all the other entries (eg. it's
+//larger than MaxSize). Should be called with the usageLock.
+func (cache *Cache) evict(store kv.KV, keep string) error {
+	if !cache.exceeded() {
+		return nil
+	}
+	candidates := make([]Entry, 0, len(cache.usage.entries))
+	for _, entry := range cache.usage.entries {
+		if entry.Key != keep {
+			candidates = append(candidates, entry)
+		}
+	}
+	sort.Slice(candidates, func(i, j int) bool {
+		return candidates[i].lastUsed().Before(candidates[j].lastUsed())
+	})
+	if entry, found := cache.usage.entries[keep]; found {
+		candidates = append(candidates, entry)
+	}
+	for _, entry := range candidates {
+		if !cache.exceeded() {
+			return nil
+		}
+		err := cache.remove(store, entry.Key)
+		if err != nil {
+			return err
+		}
+		atomic.AddInt64(&cache.counters.evictions, 1)
+		log.Debug().Msgf("'%s' is evicted from the cache", entry.Key)
+	}
+	return nil
+}
+
+func (cache *Cache) exceeded() bool {
+	return (cache.MaxSize > 0 && cache.usage.size > cache.MaxSize) ||
+		(cache.MaxEntries > 0 && len(cache.usage.entries) > cache.MaxEntries)
+}
+
+//remove deletes the value and the metadata of an entry
+func (cache *Cache) remove(store kv.KV, key string) error {
+	if memory := cache.memoryTier(); memory != nil {
+		memory.remove(key)
+	}
+	if store == nil {
+		return nil
+	}
+	err := store.Delete(cache.valueKey(key))
+	if err != nil {
+		return err
+	}
+	err = store.Delete(cache.metaKey(key))
+	if err != nil {
+		return err
+	}
+	if cache.usage != nil {
+		cache.usage.remove(key)
+	}
+	return nil
+}
+
+//touch saves the access time of an entry which is used for the LRU eviction
+func (cache *Cache) touch(store kv.KV, entry Entry) {
+	if !cache.limited() || time.Since(entry.Accessed) < accessResolution {
+		return
+	}
+	entry.Accessed = time.Now()
+	if memory := cache.memoryTier(); memory != nil {
+		memory.update(entry)
+	}
+	if store == nil {
+		return
+	}
+	err := cache.putEntry(store, entry)
+	if err != nil {
+		log.Warn().Err(err).Msgf("Couldn't update the access time of '%s'", entry.Key)
+		return
+	}
+	cache.usageLock.Lock()
+	defer cache.usageLock.Unlock()
+	if cache.usage != nil {
+		cache.usage.add(entry)
+	}
+}
+
+//Prune evicts the least recently used entries until the cache is under the MaxSize and MaxEntries limits. The usage is
+//calculated from the stored metadata, therefore the entries written by other processes are also counted.
+func (cache *Cache) Prune() error {
+	store := cache.store()
+	if store == nil || !cache.limited() {
+		return nil
+	}
+	cache.usageLock.Lock()
+	defer cache.usageLock.Unlock()
+	err := cache.loadUsage(store)
+	if err != nil {
+		return err
+	}
+	return cache.evict(store, "")
+}
+
+//Purge removes all the entries from the cache.
+func (cache *Cache) Purge() error {
+	if memory := cache.memoryTier(); memory != nil {
+		memory.clear()
+	}
+	store := cache.store()
+	if store == nil {
+		return nil
+	}
+	cache.usageLock.Lock()
+	defer cache.usageLock.Unlock()
+	entries, err := cache.entries(store)
+	if err != nil {
+		return err
+	}
+	for _, entry := range entries {
+		err = cache.remove(store, entry.Key)
+		if err != nil {
+			return err
+		}
+	}
+	cache.usage = nil
+	return nil
+}
@@ -0,0 +1,70 @@
+package cache
+
+import (
+	"github.com/pkg/errors"
+	"sync"
+)
+
+//call is a getter call in progress
+type call struct {
+	done  chan struct{}
+	value []byte
+	err   error
+}
+
+//flightGroup deduplicates the concurrent getter calls of the same key
+type flightGroup struct {
+	lock  sync.Mutex
+	calls map[string]*call
+}
+
+//do executes the function, unless it's already running for the key. In that case it waits for the result of the
+//running call.
+func (g *flightGroup) do(key string, fn func() ([]byte, error)) ([]byte, error) {
+	g.lock.Lock()
+	if g.calls == nil {
+		g.calls = make(map[string]*call)
+	}
+	if running, found := g.calls[key]; found {
+		g.lock.Unlock()
+		<-running.done
+		//the waiters get their own copy of the shared result
+		return append([]byte(nil), running.value...), running.err
+	}
+	c := &call{done: make(chan struct{})}
+	g.calls[key] = c
+	g.lock.Unlock()
+
+	returned := false
+	defer func() {
+		//the waiters get an error if the function panics (or exits the goroutine), the panic is propagated only in
+		//the calling goroutine
+		recovered := recover()
+		if !returned {
+			c.value = nil
+			if recovered != nil {
+				c.err = errors.Errorf("Getter of '%s' is panicked: %v", key, recovered)
+			} else {
+				c.err = errors.New("Getter of '" + key + "' is not finished")
+			}
+		}
+		g.lock.Lock()
+		delete(g.calls, key)
+		g.lock.Unlock()
+		close(c.done)
+		if recovered != nil {
+			panic(recovered)
+		}
+	}()
+	c.value, c.err = fn()
+	returned = true
+	return c.value, c.err
+}
+
+//running returns true if there is a call in progress for the key
+func (g *flightGroup) running(key string) bool {
+	g.lock.Lock()
+	defer g.lock.Unlock()
+	_, found := g.calls[key]
+	return found
+}
@@ -0,0 +1,59 @@
+package cache
+
+import (
+	"strings"
+	"time"
+)
+
+//InvalidateTag removes the entries with the tag and returns the number of the removed entries.
+func (cache *Cache) InvalidateTag(tag string) (int, error) {
+	return cache.invalidate(func(entry Entry) bool {
+		for _, t := range entry.Tags {
+			if t == tag {
+				return true
+			}
+		}
+		return false
+	})
+}
+
+//InvalidatePrefix removes the entries where the (original) key starts with the prefix and returns the number of the
+//removed entries.
+func (cache *Cache) InvalidatePrefix(prefix string) (int, error) {
+	return cache.invalidate(func(entry Entry) bool {
+		return strings.HasPrefix(entry.Key, prefix)
+	})
+}
+
+//InvalidateOlderThan removes the entries cached before the given age and returns the number of the removed entries.
+func (cache *Cache) InvalidateOlderThan(age time.Duration) (int, error) {
+	return cache.invalidate(func(entry Entry) bool {
+		return entry.Age() > age
+	})
+}
+
+//invalidate removes the matching entries from the store (based on the stored metadata) and from the memory tier
+func (cache *Cache) invalidate(match func(Entry) bool) (int, error) {
+	store := cache.store()
+	entries, err := cache.entries(store)
+	if err != nil {
+		return 0, err
+	}
+	if memory := cache.memoryTier(); memory != nil && store != nil {
+		entries = append(entries, memory.entries()...)
+	}
+	cache.usageLock.Lock()
+	defer cache.usageLock.Unlock()
+	removed := make(map[string]bool)
+	for _, entry := range entries {
+		if removed[entry.Key] || !match(entry) {
+			continue
+		}
+		err = cache.remove(store, entry.Key)
+		if err != nil {
+			return len(removed), err
+		}
+		removed[entry.Key] = true
+	}
+	return len(removed), nil
+}
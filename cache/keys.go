@@ -0,0 +1,81 @@
+package cache
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"path"
+	"regexp"
+	"sort"
+	"strings"
+)
+
+//maximum length of the readable part of the converted keys
+const readableKeyLength = 64
+
+//KeyMapper converts the cache keys to the keys of the store.
+type KeyMapper func(key string) string
+
+var plainKey = regexp.MustCompile(`^[A-Za-z0-9_-][A-Za-z0-9._-]{0,127}$`)
+
+var unsafeKeyCharacters = regexp.MustCompile(`[^A-Za-z0-9._-]+`)
+
+//SafeKey is the default KeyMapper. Keys which are valid file names are not changed, any other key (like URLs or JQL
+//queries) is converted to a readable file name with a hash suffix. The original keys are saved to the metadata.
+func SafeKey(key string) string {
+	if plainKey.MatchString(key) {
+		return key
+	}
+	hash := sha256.Sum256([]byte(key))
+	readable := strings.TrimLeft(unsafeKeyCharacters.ReplaceAllString(key, "_"), "._")
+	if len(readable) > readableKeyLength {
+		readable = readable[:readableKeyLength]
+	}
+	//~ is not allowed in the unchanged keys, therefore the converted keys can't collide with them
+	return readable + "~" + hex.EncodeToString(hash[:12])
+}
+
+func (cache *Cache) mapKey(key string) string {
+	if cache.KeyMapper != nil {
+		return cache.KeyMapper(key)
+	}
+	return SafeKey(key)
+}
+
+//namespace returns the prefix of the keys in the store. The keys are stored under the Prefix if the Store is shared
+//(explicitly configured), the default directory store is already specific to the Prefix.
+func (cache *Cache) namespace() string {
+	cache.lock.Lock()
+	defer cache.lock.Unlock()
+	if cache.defaultStore {
+		return ""
+	}
+	return strings.ToLower(cache.Prefix)
+}
+
+//valueKey returns the key of the cached value in the store
+func (cache *Cache) valueKey(key string) string {
+	return path.Join(cache.namespace(), cache.mapKey(key))
+}
+
+//metaKey returns the key of the metadata in the store
+func (cache *Cache) metaKey(key string) string {
+	return path.Join(cache.metaRoot(), cache.mapKey(key))
+}
+
+func (cache *Cache) metaRoot() string {
+	return path.Join(cache.namespace(), metaPrefix)
+}
+
+//Keys returns the (original) keys of the cached values and errors.
+func (cache *Cache) Keys() ([]string, error) {
+	entries, err := cache.entries(cache.store())
+	if err != nil {
+		return nil, err
+	}
+	result := make([]string, 0, len(entries))
+	for _, entry := range entries {
+		result = append(result, entry.Key)
+	}
+	sort.Strings(result)
+	return result, nil
+}
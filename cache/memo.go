@@ -0,0 +1,76 @@
+package cache
+
+import (
+	"encoding/json"
+)
+
+//Codec serializes the typed values to the cache.
+type Codec interface {
+	Marshal(value interface{}) ([]byte, error)
+	Unmarshal(data []byte, value interface{}) error
+}
+
+//JsonCodec is the default Codec.
+type JsonCodec struct{}
+
+func (JsonCodec) Marshal(value interface{}) ([]byte, error) {
+	return json.Marshal(value)
+}
+
+func (JsonCodec) Unmarshal(data []byte, value interface{}) error {
+	return json.Unmarshal(data, value)
+}
+
+//Memo caches the values of a type.
+type Memo[T any] struct {
+	Cache  *Cache
+	Policy Policy
+	//Codec serializes the values (JsonCodec if nil).
+	Codec Codec
+}
+
+func (m Memo[T]) codec() Codec {
+	if m.Codec != nil {
+		return m.Codec
+	}
+	return JsonCodec{}
+}
+
+//Get returns the cached value if it's fresh according to the Policy, otherwise calls the getter.
+func (m Memo[T]) Get(key string, getter func() (T, error)) (T, error) {
+	codec := m.codec()
+	var result T
+	content, err := m.Cache.GetWithPolicy(func() ([]byte, error) {
+		value, err := getter()
+		if err != nil {
+			return nil, err
+		}
+		return codec.Marshal(value)
+	}, key, m.Policy)
+	if err != nil {
+		return result, err
+	}
+	err = codec.Unmarshal(content, &result)
+	return result, err
+}
+
+//GetTyped returns the cached value (serialized as JSON) if it's fresh according to the policy, otherwise calls the
+//getter.
+func GetTyped[T any](cache *Cache, key string, getter func() (T, error), policy Policy) (T, error) {
+	return Memo[T]{Cache: cache, Policy: policy}.Get(key, getter)
+}
+
+//Memoize wraps a function to cache its results. The cache key is derived from the name and the JSON form of the
+//argument (use a struct for multiple arguments).
+func Memoize[A any, T any](memo Memo[T], name string, fn func(A) (T, error)) func(A) (T, error) {
+	return func(argument A) (T, error) {
+		key, err := json.Marshal(argument)
+		if err != nil {
+			var empty T
+			return empty, err
+		}
+		return memo.Get(name+":"+string(key), func() (T, error) {
+			return fn(argument)
+		})
+	}
+}
@@ -0,0 +1,54 @@
+package cache
+
+import (
+	"github.com/elek/go-utils/kv"
+	"github.com/stretchr/testify/assert"
+	"testing"
+	"time"
+)
+
+type issue struct {
+	Key    string
+	Labels []string
+}
+
+func TestGetTyped(t *testing.T) {
+	cache := CreateCache(kv.CreateMemoryKV())
+	calls := 0
+	getter := func() (issue, error) {
+		calls++
+		return issue{Key: "HDDS-1", Labels: []string{"a", "b"}}, nil
+	}
+	for i := 0; i < 2; i++ {
+		result, err := GetTyped(cache, "HDDS-1", getter, Policy{TTL: time.Minute})
+		assert.Nil(t, err)
+		assert.Equal(t, issue{Key: "HDDS-1", Labels: []string{"a", "b"}}, result)
+	}
+	assert.Equal(t, 1, calls)
+}
+
+func TestMemoize(t *testing.T) {
+	type query struct {
+		Project string
+		Status  string
+	}
+	calls := 0
+	search := Memoize(Memo[[]issue]{Cache: CreateCache(kv.CreateMemoryKV()), Policy: Policy{TTL: time.Minute}}, "search",
+		func(q query) ([]issue, error) {
+			calls++
+			return []issue{{Key: q.Project + "-1"}}, nil
+		})
+
+	result, err := search(query{Project: "HDDS", Status: "Open"})
+	assert.Nil(t, err)
+	assert.Equal(t, "HDDS-1", result[0].Key)
+
+	_, err = search(query{Project: "HDDS", Status: "Open"})
+	assert.Nil(t, err)
+	assert.Equal(t, 1, calls)
+
+	result, err = search(query{Project: "RATIS", Status: "Open"})
+	assert.Nil(t, err)
+	assert.Equal(t, "RATIS-1", result[0].Key)
+	assert.Equal(t, 2, calls)
+}
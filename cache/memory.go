@@ -0,0 +1,108 @@
+package cache
+
+import (
+	"container/list"
+	"sync"
+)
+
+//number of the entries in the memory tier if the disk tier is disabled and MemoryEntries is not set
+const defaultMemoryEntries = 1000
+
+//memoryItem is a cached value (or error) in the memory tier
+type memoryItem struct {
+	entry Entry
+	value []byte
+}
+
+//memoryTier is a bounded, in-process LRU cache in front of the store
+type memoryTier struct {
+	lock       sync.Mutex
+	maxEntries int
+	maxSize    int64
+	size       int64
+	items      map[string]*list.Element
+	//the most recently used item is at the front
+	order *list.List
+}
+
+func newMemoryTier(maxEntries int, maxSize int64) *memoryTier {
+	return &memoryTier{
+		maxEntries: maxEntries,
+		maxSize:    maxSize,
+		items:      make(map[string]*list.Element),
+		order:      list.New(),
+	}
+}
+
+//get returns a copy of the cached item and marks it as the most recently used one
+func (m *memoryTier) get(key string) (memoryItem, bool) {
+	m.lock.Lock()
+	defer m.lock.Unlock()
+	element, found := m.items[key]
+	if !found {
+		return memoryItem{}, false
+	}
+	m.order.MoveToFront(element)
+	item := element.Value.(memoryItem)
+	item.value = append([]byte(nil), item.value...)
+	return item, true
+}
+
+//put saves the item and returns the number of the evicted items
+func (m *memoryTier) put(item memoryItem) int {
+	m.lock.Lock()
+	defer m.lock.Unlock()
+	m.removeItem(item.entry.Key)
+	item.value = append([]byte(nil), item.value...)
+	m.items[item.entry.Key] = m.order.PushFront(item)
+	m.size += int64(len(item.value))
+	evicted := 0
+	for m.order.Len() > 1 && (m.order.Len() > m.maxEntries || (m.maxSize > 0 && m.size > m.maxSize)) {
+		m.removeItem(m.order.Back().Value.(memoryItem).entry.Key)
+		evicted++
+	}
+	return evicted
+}
+
+//update replaces the metadata of an item if it's in the memory
+func (m *memoryTier) update(entry Entry) {
+	m.lock.Lock()
+	defer m.lock.Unlock()
+	if element, found := m.items[entry.Key]; found {
+		item := element.Value.(memoryItem)
+		item.entry = entry
+		element.Value = item
+	}
+}
+
+func (m *memoryTier) remove(key string) {
+	m.lock.Lock()
+	defer m.lock.Unlock()
+	m.removeItem(key)
+}
+
+func (m *memoryTier) removeItem(key string) {
+	if element, found := m.items[key]; found {
+		m.size -= int64(len(element.Value.(memoryItem).value))
+		m.order.Remove(element)
+		delete(m.items, key)
+	}
+}
+
+func (m *memoryTier) entries() []Entry {
+	m.lock.Lock()
+	defer m.lock.Unlock()
+	result := make([]Entry, 0, len(m.items))
+	for _, element := range m.items {
+		result = append(result, element.Value.(memoryItem).entry)
+	}
+	return result
+}
+
+func (m *memoryTier) clear() {
+	m.lock.Lock()
+	defer m.lock.Unlock()
+	m.items = make(map[string]*list.Element)
+	m.order.Init()
+	m.size = 0
+}
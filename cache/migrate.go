@@ -0,0 +1,74 @@
+package cache
+
+import (
+	"encoding/json"
+	"github.com/elek/go-utils/kv"
+	"github.com/rs/zerolog/log"
+	"os"
+	"path"
+)
+
+//migrate adds the metadata to the values of the default directory store which are cached by the earlier versions
+//(they saved only the values, under the original keys). The modification time of the file is used as the creation
+//time, therefore the validators work as before. Runs only if there is no metadata in the directory yet. Should be
+//called with the lock.
+func (cache *Cache) migrate(store *kv.DirKV) {
+	if _, err := os.Stat(path.Join(store.Path, metaPrefix)); !os.IsNotExist(err) {
+		return
+	}
+	keys := make([]string, 0)
+	err := store.IterateAll(func(key string) error {
+		keys = append(keys, key)
+		return nil
+	})
+	if err != nil {
+		log.Warn().Err(err).Msgf("Couldn't list the cached values of %s", store.Path)
+		return
+	}
+	for _, key := range keys {
+		err = cache.migrateValue(store, key)
+		if err != nil {
+			log.Warn().Err(err).Msgf("Couldn't migrate the cached value of '%s'", key)
+		}
+	}
+	if len(keys) > 0 {
+		log.Debug().Msgf("%d cached values are migrated in %s", len(keys), store.Path)
+	}
+}
+
+func (cache *Cache) migrateValue(store *kv.DirKV, key string) error {
+	file := path.Join(store.Path, key)
+	stat, err := os.Stat(file)
+	if err != nil {
+		return err
+	}
+	//the old files could be readable by anybody
+	err = os.Chmod(file, store.FileMode)
+	if err != nil {
+		return err
+	}
+	mapped := cache.mapKey(key)
+	if mapped != key {
+		value, err := store.Get(key)
+		if err != nil {
+			return err
+		}
+		err = store.Put(mapped, value)
+		if err != nil {
+			return err
+		}
+		err = store.Delete(key)
+		if err != nil {
+			return err
+		}
+	}
+	content, err := json.Marshal(Entry{
+		Key:     key,
+		Created: stat.ModTime(),
+		Size:    stat.Size(),
+	})
+	if err != nil {
+		return err
+	}
+	return store.Put(path.Join(metaPrefix, mapped), content)
+}
@@ -0,0 +1,101 @@
+package cache
+
+import (
+	"github.com/elek/go-utils/kv"
+	"github.com/pkg/errors"
+	"github.com/rs/zerolog/log"
+	"sync/atomic"
+	"time"
+)
+
+//Policy defines how long the cached values (and errors) are used.
+type Policy struct {
+	//TTL is the age until the cached value is returned without calling the getter.
+	TTL time.Duration
+	//MaxStale is the additional time after the TTL while the expired value is returned if the getter fails.
+	MaxStale time.Duration
+	//RefreshAhead is the time before the expiration when the cached value is still returned, but the getter is
+	//called in the background to refresh it.
+	RefreshAhead time.Duration
+	//ErrorTTL is the time until the failures of the getter are cached and returned without calling the getter
+	//again. Errors are not cached if it's zero.
+	ErrorTTL time.Duration
+	//Tags are saved to the metadata of the cached values and errors (see InvalidateTag).
+	Tags []string
+}
+
+//GetWithPolicy returns the cached value if it's fresh according to the policy, otherwise calls the getter.
+func (cache *Cache) GetWithPolicy(getter Getter, key string, policy Policy) ([]byte, error) {
+	store := cache.store()
+	if !cache.enabled(store) {
+		return getter()
+	}
+	entry, found := cache.entry(store, key)
+	if found {
+		age := entry.Age()
+		if entry.Error != "" {
+			if age < policy.ErrorTTL {
+				atomic.AddInt64(&cache.counters.hits, 1)
+				log.Debug().Msgf("Cached error is returned for '%s'", key)
+				return nil, errors.New(entry.Error + " (cached error)")
+			}
+		} else if age < policy.TTL {
+			value, err := cache.read(store, entry)
+			if err == nil {
+				if policy.RefreshAhead > 0 && age > policy.TTL-policy.RefreshAhead {
+					cache.refresh(store, getter, key, policy)
+				}
+				atomic.AddInt64(&cache.counters.hits, 1)
+				return value, nil
+			}
+			//the value can be evicted or deleted after the metadata is read
+			log.Debug().Err(err).Msgf("Cached value of '%s' is unreadable, calling the getter", key)
+		}
+	}
+	atomic.AddInt64(&cache.counters.misses, 1)
+	return cache.flight.do(key, func() ([]byte, error) {
+		return cache.fetch(store, getter, key, policy)
+	})
+}
+
+//fetch calls the getter and caches the result
+func (cache *Cache) fetch(store kv.KV, getter Getter, key string, policy Policy) ([]byte, error) {
+	result, err := cache.call(getter)
+	if err != nil {
+		//the entry is read again, it may be refreshed by a concurrent call
+		entry, found := cache.entry(store, key)
+		if found && entry.Error == "" && entry.Age() < policy.TTL+policy.MaxStale {
+			if value, readErr := cache.read(store, entry); readErr == nil {
+				log.Warn().Err(err).Msgf("Getter of '%s' is failed, stale value is returned from the cache", key)
+				atomic.AddInt64(&cache.counters.staleServes, 1)
+				return value, nil
+			}
+		}
+		if policy.ErrorTTL > 0 {
+			if cacheErr := cache.putError(store, key, err, policy.Tags); cacheErr != nil {
+				log.Warn().Err(cacheErr).Msgf("Couldn't cache the error of '%s'", key)
+			}
+		}
+		return nil, err
+	}
+	err = cache.put(store, key, result, policy.Tags)
+	if err != nil {
+		return nil, err
+	}
+	return result, nil
+}
+
+//refresh calls the getter in the background and updates the cached value, unless it's already in progress
+func (cache *Cache) refresh(store kv.KV, getter Getter, key string, policy Policy) {
+	if cache.flight.running(key) {
+		return
+	}
+	go func() {
+		_, err := cache.flight.do(key, func() ([]byte, error) {
+			return cache.fetch(store, getter, key, policy)
+		})
+		if err != nil {
+			log.Warn().Err(err).Msgf("Background refresh of '%s' is failed", key)
+		}
+	}()
+}
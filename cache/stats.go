@@ -0,0 +1,127 @@
+package cache
+
+import (
+	"expvar"
+	"fmt"
+	"io"
+	"sync/atomic"
+	"time"
+)
+
+//Stats are the counters of a Cache since its creation.
+type Stats struct {
+	//Hits is the number of the fresh values (or cached errors) returned without calling the getter.
+	Hits int64
+	//Misses is the number of the calls where the getter is called (or waited for).
+	Misses int64
+	//StaleServes is the number of the expired values returned because the getter is failed.
+	StaleServes int64
+	//Revalidations is the number of the expired HTTP responses returned after a 304 (Not Modified) response.
+	Revalidations int64
+	//Evictions is the number of the entries removed because of the MaxSize and MaxEntries limits.
+	Evictions    int64
+	BytesRead    int64
+	BytesWritten int64
+	GetterCalls  int64
+	GetterErrors int64
+	//GetterTime is the total time spent in the getters.
+	GetterTime time.Duration
+}
+
+//counters are updated atomically, the struct should be 64-bit aligned
+type counters struct {
+	hits          int64
+	misses        int64
+	staleServes   int64
+	revalidations int64
+	evictions     int64
+	bytesRead     int64
+	bytesWritten  int64
+	getterCalls   int64
+	getterErrors  int64
+	getterTime    int64
+}
+
+//Stats returns the current values of the counters.
+func (cache *Cache) Stats() Stats {
+	c := &cache.counters
+	return Stats{
+		Hits:          atomic.LoadInt64(&c.hits),
+		Misses:        atomic.LoadInt64(&c.misses),
+		StaleServes:   atomic.LoadInt64(&c.staleServes),
+		Revalidations: atomic.LoadInt64(&c.revalidations),
+		Evictions:     atomic.LoadInt64(&c.evictions),
+		BytesRead:     atomic.LoadInt64(&c.bytesRead),
+		BytesWritten:  atomic.LoadInt64(&c.bytesWritten),
+		GetterCalls:   atomic.LoadInt64(&c.getterCalls),
+		GetterErrors:  atomic.LoadInt64(&c.getterErrors),
+		GetterTime:    time.Duration(atomic.LoadInt64(&c.getterTime)),
+	}
+}
+
+//call executes the getter and measures its latency
+func (cache *Cache) call(getter Getter) ([]byte, error) {
+	start := time.Now()
+	result, err := getter()
+	cache.getterCalled(start, err)
+	return result, err
+}
+
+func (cache *Cache) getterCalled(start time.Time, err error) {
+	atomic.AddInt64(&cache.counters.getterCalls, 1)
+	atomic.AddInt64(&cache.counters.getterTime, int64(time.Since(start)))
+	if err != nil {
+		atomic.AddInt64(&cache.counters.getterErrors, 1)
+	}
+}
+
+//PublishExpvar exposes the Stats of the cache as an expvar variable. It panics if the name is already used.
+func (cache *Cache) PublishExpvar(name string) {
+	expvar.Publish(name, expvar.Func(func() interface{} {
+		return cache.Stats()
+	}))
+}
+
+//WritePrometheus writes the Stats of the caches in the Prometheus text format. The caches are labeled with their Prefix.
+func WritePrometheus(w io.Writer, caches ...*Cache) error {
+	stats := make([]Stats, len(caches))
+	for i, cache := range caches {
+		stats[i] = cache.Stats()
+	}
+	metrics := []struct {
+		name  string
+		help  string
+		value func(s Stats) string
+	}{
+		{"hits_total", "Number of the values returned from the cache.", func(s Stats) string { return fmt.Sprint(s.Hits) }},
+		{"misses_total", "Number of the requests where the getter is called.", func(s Stats) string { return fmt.Sprint(s.Misses) }},
+		{"stale_serves_total", "Number of the expired values returned because the getter is failed.", func(s Stats) string { return fmt.Sprint(s.StaleServes) }},
+		{"revalidations_total", "Number of the expired HTTP responses returned after a Not Modified response.", func(s Stats) string { return fmt.Sprint(s.Revalidations) }},
+		{"evictions_total", "Number of the entries evicted because of the size limits.", func(s Stats) string { return fmt.Sprint(s.Evictions) }},
+		{"read_bytes_total", "Size of the values read from the cache.", func(s Stats) string { return fmt.Sprint(s.BytesRead) }},
+		{"written_bytes_total", "Size of the values written to the cache.", func(s Stats) string { return fmt.Sprint(s.BytesWritten) }},
+		{"getter_calls_total", "Number of the getter calls.", func(s Stats) string { return fmt.Sprint(s.GetterCalls) }},
+		{"getter_errors_total", "Number of the failed getter calls.", func(s Stats) string { return fmt.Sprint(s.GetterErrors) }},
+		{"getter_seconds_total", "Time spent in the getter calls.", func(s Stats) string { return fmt.Sprint(s.GetterTime.Seconds()) }},
+	}
+	for _, metric := range metrics {
+		_, err := fmt.Fprintf(w, "# HELP cache_%s %s\n# TYPE cache_%s counter\n", metric.name, metric.help, metric.name)
+		if err != nil {
+			return err
+		}
+		for i, cache := range caches {
+			_, err = fmt.Fprintf(w, "cache_%s{cache=%q} %s\n", metric.name, cacheLabel(cache), metric.value(stats[i]))
+			if err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+func cacheLabel(cache *Cache) string {
+	if cache.Prefix == "" {
+		return "default"
+	}
+	return cache.Prefix
+}
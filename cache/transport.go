@@ -0,0 +1,218 @@
+package cache
+
+import (
+	"bufio"
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"github.com/rs/zerolog/log"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"net/http/httputil"
+	"strconv"
+	"strings"
+	"sync/atomic"
+	"time"
+)
+
+//Transport is an http.RoundTripper which caches the responses of the GET requests. Fresh responses (according to
+//the Cache-Control and Expires headers) are returned without calling the server, the expired responses are
+//revalidated with If-None-Match / If-Modified-Since requests.
+type Transport struct {
+	Cache *Cache
+	//Transport executes the requests (http.DefaultTransport if nil).
+	Transport http.RoundTripper
+	//DefaultTTL is the freshness of the responses without Cache-Control max-age and Expires headers.
+	DefaultTTL time.Duration
+}
+
+//CreateTransport creates a caching transport which can be used as the Transport of an http.Client.
+func CreateTransport(cache *Cache) *Transport {
+	return &Transport{
+		Cache: cache,
+	}
+}
+
+func (t *Transport) transport() http.RoundTripper {
+	if t.Transport != nil {
+		return t.Transport
+	}
+	return http.DefaultTransport
+}
+
+//requestKey returns the cache key of the request. The credentials are included as a hash, as the responses can be
+//different for the different users.
+func requestKey(req *http.Request) string {
+	key := req.Method + " " + req.URL.String()
+	if accept := req.Header.Get("Accept"); accept != "" {
+		key += " accept=" + accept
+	}
+	if authorization := req.Header.Get("Authorization"); authorization != "" {
+		hash := sha256.Sum256([]byte(authorization))
+		key += " auth=" + hex.EncodeToString(hash[:8])
+	}
+	return key
+}
+
+func parseCacheControl(header string) map[string]string {
+	result := make(map[string]string)
+	for _, directive := range strings.Split(header, ",") {
+		parts := strings.SplitN(strings.TrimSpace(directive), "=", 2)
+		if parts[0] == "" {
+			continue
+		}
+		value := ""
+		if len(parts) == 2 {
+			value = strings.Trim(parts[1], "\"")
+		}
+		result[strings.ToLower(parts[0])] = value
+	}
+	return result
+}
+
+//freshness returns how long the response can be used without revalidation, and false if it shouldn't be stored
+func (t *Transport) freshness(resp *http.Response) (time.Duration, bool) {
+	if resp.StatusCode != http.StatusOK {
+		return 0, false
+	}
+	cacheControl := parseCacheControl(resp.Header.Get("Cache-Control"))
+	if _, found := cacheControl["no-store"]; found {
+		return 0, false
+	}
+	if _, found := cacheControl["no-cache"]; found {
+		return 0, true
+	}
+	if maxAge, found := cacheControl["max-age"]; found {
+		seconds, err := strconv.Atoi(maxAge)
+		if err == nil {
+			return time.Duration(seconds) * time.Second, true
+		}
+	}
+	if expires := resp.Header.Get("Expires"); expires != "" {
+		expiration, err := http.ParseTime(expires)
+		if err != nil {
+			//invalid Expires means already expired
+			return 0, true
+		}
+		date, err := http.ParseTime(resp.Header.Get("Date"))
+		if err != nil {
+			date = time.Now()
+		}
+		if expiration.Before(date) {
+			return 0, true
+		}
+		return expiration.Sub(date), true
+	}
+	return t.DefaultTTL, true
+}
+
+func (t *Transport) RoundTrip(req *http.Request) (*http.Response, error) {
+	store := t.Cache.store()
+	requestCacheControl := parseCacheControl(req.Header.Get("Cache-Control"))
+	_, noStore := requestCacheControl["no-store"]
+	if !t.Cache.enabled(store) || req.Method != http.MethodGet || req.Header.Get("Range") != "" || noStore {
+		return t.transport().RoundTrip(req)
+	}
+	key := requestKey(req)
+
+	var cached *http.Response
+	if entry, found := t.Cache.entry(store, key); found && entry.Error == "" {
+		content, err := t.Cache.read(store, entry)
+		if err == nil {
+			cached, err = http.ReadResponse(bufio.NewReader(bytes.NewReader(content)), req)
+		}
+		if err != nil {
+			cached = nil
+		} else {
+			ttl, _ := t.freshness(cached)
+			_, noCache := requestCacheControl["no-cache"]
+			if entry.Age() < ttl && !noCache {
+				atomic.AddInt64(&t.Cache.counters.hits, 1)
+				cached.Header.Set("X-From-Cache", "1")
+				return cached, nil
+			}
+		}
+	}
+
+	outgoing := req
+	if cached != nil {
+		etag := cached.Header.Get("ETag")
+		lastModified := cached.Header.Get("Last-Modified")
+		if etag != "" || lastModified != "" {
+			outgoing = req.Clone(req.Context())
+			if etag != "" {
+				outgoing.Header.Set("If-None-Match", etag)
+			}
+			if lastModified != "" {
+				outgoing.Header.Set("If-Modified-Since", lastModified)
+			}
+		}
+	}
+	start := time.Now()
+	resp, err := t.transport().RoundTrip(outgoing)
+	t.Cache.getterCalled(start, err)
+	if err != nil {
+		atomic.AddInt64(&t.Cache.counters.misses, 1)
+		return nil, err
+	}
+
+	if resp.StatusCode == http.StatusNotModified && cached != nil && outgoing != req {
+		_ = resp.Body.Close()
+		//the new headers (like Date, Cache-Control or ETag) of the 304 response replace the stored ones
+		for name, values := range resp.Header {
+			cached.Header[name] = values
+		}
+		t.save(key, cached)
+		atomic.AddInt64(&t.Cache.counters.revalidations, 1)
+		cached.Header.Set("X-From-Cache", "1")
+		return cached, nil
+	}
+	atomic.AddInt64(&t.Cache.counters.misses, 1)
+	//responses which are expired immediately are stored only if they can be revalidated
+	ttl, cacheable := t.freshness(resp)
+	if cacheable && (ttl > 0 || resp.Header.Get("ETag") != "" || resp.Header.Get("Last-Modified") != "") {
+		t.save(key, resp)
+	}
+	return resp, nil
+}
+
+//save saves the response to the cache. The body of the response is replaced with an in-memory copy. The response is
+//returned even if it can't be cached, therefore the errors are only logged.
+func (t *Transport) save(key string, resp *http.Response) {
+	err := t.store(key, resp)
+	if err != nil {
+		log.Warn().Err(err).Msgf("Couldn't cache the response of '%s'", key)
+	}
+}
+
+func (t *Transport) store(key string, resp *http.Response) error {
+	body, err := ioutil.ReadAll(resp.Body)
+	_ = resp.Body.Close()
+	if err != nil {
+		//the failure is reported to the reader of the body after the already read part
+		resp.Body = ioutil.NopCloser(io.MultiReader(bytes.NewReader(body), errorReader{err: err}))
+		return err
+	}
+	resp.Body = ioutil.NopCloser(bytes.NewReader(body))
+	resp.ContentLength = int64(len(body))
+	resp.TransferEncoding = nil
+	resp.Header.Del("Transfer-Encoding")
+	resp.Header.Set("Content-Length", strconv.Itoa(len(body)))
+	content, err := httputil.DumpResponse(resp, true)
+	if err != nil {
+		return err
+	}
+	resp.Body = ioutil.NopCloser(bytes.NewReader(body))
+	store := t.Cache.store()
+	return t.Cache.put(store, key, content, nil)
+}
+
+//errorReader is a reader which always fails with the error
+type errorReader struct {
+	err error
+}
+
+func (r errorReader) Read(p []byte) (int, error) {
+	return 0, r.err
+}
@@ -0,0 +1,129 @@
+package cache
+
+import (
+	"github.com/elek/go-utils/kv"
+	"github.com/pkg/errors"
+	"github.com/stretchr/testify/assert"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+)
+
+func TestTransport(t *testing.T) {
+	requests := int32(0)
+	notModified := int32(0)
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		atomic.AddInt32(&requests, 1)
+		switch r.URL.Path {
+		case "/fresh":
+			w.Header().Set("Cache-Control", "private, max-age=60")
+		case "/etag":
+			w.Header().Set("Cache-Control", "max-age=0")
+			w.Header().Set("ETag", "\"v1\"")
+			if r.Header.Get("If-None-Match") == "\"v1\"" {
+				atomic.AddInt32(&notModified, 1)
+				w.WriteHeader(http.StatusNotModified)
+				return
+			}
+		case "/nostore":
+			w.Header().Set("Cache-Control", "no-store")
+		}
+		_, _ = w.Write([]byte("content of " + r.URL.Path))
+	}))
+	defer server.Close()
+
+	client := &http.Client{Transport: CreateTransport(CreateCache(kv.CreateMemoryKV()))}
+	get := func(path string) (string, string) {
+		resp, err := client.Get(server.URL + path)
+		assert.Nil(t, err)
+		defer resp.Body.Close()
+		body, err := ioutil.ReadAll(resp.Body)
+		assert.Nil(t, err)
+		assert.Equal(t, http.StatusOK, resp.StatusCode)
+		return string(body), resp.Header.Get("X-From-Cache")
+	}
+
+	body, fromCache := get("/fresh")
+	assert.Equal(t, "content of /fresh", body)
+	assert.Equal(t, "", fromCache)
+	body, fromCache = get("/fresh")
+	assert.Equal(t, "content of /fresh", body)
+	assert.Equal(t, "1", fromCache)
+	assert.Equal(t, int32(1), requests)
+
+	//expired immediately, but revalidated with the ETag
+	get("/etag")
+	body, fromCache = get("/etag")
+	assert.Equal(t, "content of /etag", body)
+	assert.Equal(t, "1", fromCache)
+	assert.Equal(t, int32(3), requests)
+	assert.Equal(t, int32(1), notModified)
+	assert.Equal(t, int64(1), client.Transport.(*Transport).Cache.Stats().Revalidations)
+
+	get("/nostore")
+	body, fromCache = get("/nostore")
+	assert.Equal(t, "content of /nostore", body)
+	assert.Equal(t, "", fromCache)
+	assert.Equal(t, int32(5), requests)
+}
+
+//failingKV rejects the writes if fail is set
+type failingKV struct {
+	kv.KV
+	fail bool
+}
+
+func (f *failingKV) Put(key string, value []byte) error {
+	if f.fail {
+		return errors.New("store is full")
+	}
+	return f.KV.Put(key, value)
+}
+
+func TestTransportStoreFailure(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/etag":
+			w.Header().Set("Cache-Control", "max-age=0")
+			w.Header().Set("ETag", "\"v1\"")
+			if r.Header.Get("If-None-Match") == "\"v1\"" {
+				w.WriteHeader(http.StatusNotModified)
+				return
+			}
+		case "/expired":
+			w.Header().Set("Cache-Control", "max-age=0")
+		case "/fresh":
+			w.Header().Set("Cache-Control", "max-age=60")
+		}
+		_, _ = w.Write([]byte("content of " + r.URL.Path))
+	}))
+	defer server.Close()
+
+	store := &failingKV{KV: kv.CreateMemoryKV()}
+	cache := CreateCache(store)
+	client := &http.Client{Transport: CreateTransport(cache)}
+	get := func(path string) string {
+		resp, err := client.Get(server.URL + path)
+		assert.Nil(t, err)
+		defer resp.Body.Close()
+		body, err := ioutil.ReadAll(resp.Body)
+		assert.Nil(t, err)
+		return string(body)
+	}
+
+	//expired responses without validator are not stored
+	assert.Equal(t, "content of /expired", get("/expired"))
+	keys, err := cache.Keys()
+	assert.Nil(t, err)
+	assert.Equal(t, 0, len(keys))
+
+	assert.Equal(t, "content of /etag", get("/etag"))
+	store.fail = true
+	//revalidated (304)
+	assert.Equal(t, "content of /etag", get("/etag"))
+	//downloaded (200)
+	assert.Equal(t, "content of /fresh", get("/fresh"))
+	assert.Equal(t, int64(1), cache.Stats().Revalidations)
+}
@@ -19,12 +19,15 @@ import (
 
 type Processor func(data []byte, err error) error
 
+//HttpClient is used for all the GitHub API calls. It can be replaced, for example to use a cache.Transport.
+var HttpClient = &http.Client{}
+
 func CallGithubApiV3(method string, url string) (*http.Response, error) {
 	return CallGithubApiV3WithBody(method, url, []byte{})
 }
 
 func CallGithubApiV3WithBody(method string, url string, body []byte) (*http.Response, error) {
-	client := &http.Client{}
+	client := HttpClient
 	log.Debug().Msgf("%s url from GITHUB api: %s ", method, url)
 	var req *http.Request
 	var err error
@@ -59,7 +62,7 @@ func CallGithubApiV3WithBody(method string, url string, body []byte) (*http.Resp
 }
 
 func ReadGithubApiV3(url string) ([]byte, error) {
-	client := &http.Client{}
+	client := HttpClient
 	log.Debug().Msgf("Reading url from GITHUB api: %s", url)
 
 	req, err := http.NewRequest("GET", url, nil)
@@ -142,7 +145,7 @@ func parseLinkHeader(header string) map[string]string {
 }
 
 func ReadGithubApiV4Query(query []byte) ([]byte, error) {
-	client := &http.Client{}
+	client := HttpClient
 
 	queryPayload := make(map[string]string)
 	queryPayload["query"] = string(query)
@@ -18,6 +18,15 @@ import (
 type Jira struct {
 	Url  string
 	User string
+	//Client is used for the API calls (a new http.Client if nil). It can be used to set a cache.Transport.
+	Client *http.Client
+}
+
+func (jira *Jira) client() *http.Client {
+	if jira.Client != nil {
+		return jira.Client
+	}
+	return &http.Client{}
 }
 
 func (jira *Jira) CreateRequest(method, url string, body io.Reader) (*http.Request, error) {
@@ -40,7 +49,7 @@ func (jira *Jira) getToken() string {
 func (jira *Jira) DoTransition(jiraId string, transitionId string, updated map[string]interface{}) ([]byte, error) {
 	queryUrl := jira.Url + "/rest/api/2/issue/" + jiraId + "/transitions"
 
-	client := &http.Client{}
+	client := jira.client()
 	log.Debug().Msgf("%s url from JIRA api: %s %s ", "GET", jira.Url, queryUrl)
 
 	requestBody := make(map[string]interface{})
@@ -75,7 +84,7 @@ func (jira *Jira) DoTransition(jiraId string, transitionId string, updated map[s
 func (jira *Jira) ListProject() ([]byte, error) {
 	queryUrl := jira.Url + "/rest/api/2/project"
 
-	client := &http.Client{}
+	client := jira.client()
 	log.Debug().Msgf("%s url from JIRA api: %s %s ", "GET", jira.Url, queryUrl)
 	req, err := jira.CreateRequest("GET", queryUrl, nil)
 
@@ -101,7 +110,7 @@ func (jira *Jira) ListProject() ([]byte, error) {
 func (jira *Jira) GetJira(id string) ([]byte, error) {
 	queryUrl := jira.Url + "/rest/api/2/issue/" + id + "?expand=editmeta"
 
-	client := &http.Client{}
+	client := jira.client()
 	log.Debug().Msgf("%s url from JIRA api: %s %s ", "GET", jira.Url, queryUrl)
 	req, err := jira.CreateRequest("GET", queryUrl, nil)
 
@@ -127,7 +136,7 @@ func (jira *Jira) GetJira(id string) ([]byte, error) {
 func (jira *Jira) CreateJira(fields map[string]interface{}) (string, error) {
 	queryUrl := jira.Url + "/rest/api/2/issue"
 
-	client := &http.Client{}
+	client := jira.client()
 	log.Debug().Msgf("%s url from JIRA api: %s %s ", "POST", jira.Url, queryUrl)
 
 	requestBody := map[string]interface{}{
@@ -158,7 +167,7 @@ func (jira *Jira) CreateJira(fields map[string]interface{}) (string, error) {
 func (jira *Jira) GetTransitions(id string) ([]byte, error) {
 	queryUrl := jira.Url + "/rest/api/2/issue/" + id + "/transitions"
 
-	client := &http.Client{}
+	client := jira.client()
 	log.Debug().Msgf("%s url from JIRA api: %s %s ", "GET", jira.Url, queryUrl)
 	req, err := jira.CreateRequest("GET", queryUrl, nil)
 
@@ -184,7 +193,7 @@ func (jira *Jira) GetTransitions(id string) ([]byte, error) {
 func (jira *Jira) ReadSearch(query string) ([]byte, error) {
 	queryUrl := jira.Url + "/rest/api/2/search?"
 
-	client := &http.Client{}
+	client := jira.client()
 
 	encodedQuery := "expand=changelog%2Ccomments&fields=%2Aall&maxResults=100&jql=" + url.QueryEscape(query)
 	finalUrl := queryUrl + "&" + encodedQuery
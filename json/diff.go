@@ -0,0 +1,87 @@
+package json
+
+import (
+	"encoding/json"
+	"fmt"
+	"sort"
+	"strconv"
+)
+
+const missing = "(missing)"
+
+//Diff compares two unstructured json objects and returns the differences as "path: old -> new" lines
+func Diff(a interface{}, b interface{}) []string {
+	result := make([]string, 0)
+	return diff("", a, b, result)
+}
+
+func diff(path string, a interface{}, b interface{}, result []string) []string {
+	switch aValue := a.(type) {
+	case map[string]interface{}:
+		if bValue, ok := b.(map[string]interface{}); ok {
+			keys := make([]string, 0)
+			for key := range aValue {
+				keys = append(keys, key)
+			}
+			for key := range bValue {
+				if _, found := aValue[key]; !found {
+					keys = append(keys, key)
+				}
+			}
+			sort.Strings(keys)
+			for _, key := range keys {
+				aField, aFound := aValue[key]
+				bField, bFound := bValue[key]
+				childPath := joinPath(path, key)
+				if !aFound {
+					result = append(result, childPath+": "+missing+" -> "+format(bField))
+				} else if !bFound {
+					result = append(result, childPath+": "+format(aField)+" -> "+missing)
+				} else {
+					result = diff(childPath, aField, bField, result)
+				}
+			}
+			return result
+		}
+	case []interface{}:
+		if bValue, ok := b.([]interface{}); ok {
+			for i := 0; i < len(aValue) || i < len(bValue); i++ {
+				childPath := path + "[" + strconv.Itoa(i) + "]"
+				if i >= len(aValue) {
+					result = append(result, childPath+": "+missing+" -> "+format(bValue[i]))
+				} else if i >= len(bValue) {
+					result = append(result, childPath+": "+format(aValue[i])+" -> "+missing)
+				} else {
+					result = diff(childPath, aValue[i], bValue[i], result)
+				}
+			}
+			return result
+		}
+	}
+	aFormatted, bFormatted := format(a), format(b)
+	if aFormatted != bFormatted {
+		result = append(result, joinPath(path, "")+": "+aFormatted+" -> "+bFormatted)
+	}
+	return result
+}
+
+func joinPath(path string, key string) string {
+	if path == "" {
+		if key == "" {
+			return "."
+		}
+		return key
+	}
+	if key == "" {
+		return path
+	}
+	return path + "." + key
+}
+
+func format(value interface{}) string {
+	content, err := json.Marshal(value)
+	if err != nil {
+		return fmt.Sprintf("%v", value)
+	}
+	return string(content)
+}
@@ -0,0 +1,20 @@
+package json
+
+import (
+	"github.com/stretchr/testify/assert"
+	"testing"
+)
+
+func TestDiff(t *testing.T) {
+	a, err := AsJson([]byte(`{"fields":{"status":{"name":"Open"},"labels":["a","b"]},"id":1}`), nil)
+	assert.Nil(t, err)
+	b, err := AsJson([]byte(`{"fields":{"status":{"name":"Resolved"},"labels":["a"]},"id":1,"key":"HDDS-1"}`), nil)
+	assert.Nil(t, err)
+
+	assert.Equal(t, []string{
+		"fields.labels[1]: \"b\" -> (missing)",
+		"fields.status.name: \"Open\" -> \"Resolved\"",
+		"key: (missing) -> \"HDDS-1\"",
+	}, Diff(a, b))
+	assert.Equal(t, []string{}, Diff(a, a))
+}
@@ -0,0 +1,259 @@
+package kv
+
+import (
+	"archive/tar"
+	"compress/gzip"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"github.com/pkg/errors"
+	"hash"
+	"io"
+	"io/ioutil"
+	"os"
+	"path"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Archives created by Export are backend independent gzip compressed tar files with the following entries:
+//
+//	data/<key>     one entry for each key, the content is the raw value. The hex encoded sha256 checksum of the
+//	               value is stored in the GOUTILS.sha256 PAX record of the entry.
+//	MANIFEST.json  the last entry with the Manifest of the archive.
+//
+// The manifest is written at the end to make it possible to stream the export without knowing the number of keys in
+// advance.
+const (
+	archiveDataPrefix    = "data/"
+	archiveManifestName  = "MANIFEST.json"
+	archiveChecksumKey   = "GOUTILS.sha256"
+	archiveFormatVersion = 1
+)
+
+// Manifest describes the content of an archive.
+type Manifest struct {
+	Version int       `json:"version"`
+	Created time.Time `json:"created"`
+	// Count is the number of the keys in the archive.
+	Count int `json:"count"`
+	// Bytes is the total size of the values.
+	Bytes int64 `json:"bytes"`
+	// Checksum is the sha256 checksum of the "<key>\x00<value checksum>\n" lines of the entries (in archive order).
+	Checksum string `json:"sha256"`
+}
+
+type manifestBuilder struct {
+	manifest Manifest
+	digest   hash.Hash
+}
+
+func newManifestBuilder() *manifestBuilder {
+	return &manifestBuilder{
+		manifest: Manifest{
+			Version: archiveFormatVersion,
+			Created: time.Now().UTC(),
+		},
+		digest: sha256.New(),
+	}
+}
+
+func (m *manifestBuilder) add(key string, size int64, checksum string) {
+	m.manifest.Count++
+	m.manifest.Bytes += size
+	_, _ = io.WriteString(m.digest, key+"\x00"+checksum+"\n")
+}
+
+func (m *manifestBuilder) build() Manifest {
+	m.manifest.Checksum = hex.EncodeToString(m.digest.Sum(nil))
+	return m.manifest
+}
+
+// Export writes all the keys of the store to the writer as a gzip compressed tar archive. Values are streamed one by
+// one, the full store is never loaded into the memory.
+func Export(from KV, w io.Writer) (Manifest, error) {
+	gz := gzip.NewWriter(w)
+	archive := tar.NewWriter(gz)
+	manifest := newManifestBuilder()
+	err := from.IterateAll(func(key string) error {
+		value, err := from.Get(key)
+		if err != nil {
+			return errors.Wrap(err, "Couldn't read key "+key)
+		}
+		checksum := sha256.Sum256(value)
+		checksumHex := hex.EncodeToString(checksum[:])
+		err = archive.WriteHeader(&tar.Header{
+			Typeflag:   tar.TypeReg,
+			Name:       archiveDataPrefix + key,
+			Size:       int64(len(value)),
+			Mode:       0644,
+			ModTime:    manifest.manifest.Created,
+			Format:     tar.FormatPAX,
+			PAXRecords: map[string]string{archiveChecksumKey: checksumHex},
+		})
+		if err != nil {
+			return err
+		}
+		_, err = archive.Write(value)
+		if err != nil {
+			return err
+		}
+		manifest.add(key, int64(len(value)), checksumHex)
+		return nil
+	})
+	if err != nil {
+		return Manifest{}, err
+	}
+	result := manifest.build()
+	content, err := json.MarshalIndent(result, "", "  ")
+	if err != nil {
+		return Manifest{}, err
+	}
+	err = archive.WriteHeader(&tar.Header{
+		Typeflag: tar.TypeReg,
+		Name:     archiveManifestName,
+		Size:     int64(len(content)),
+		Mode:     0644,
+		ModTime:  result.Created,
+	})
+	if err != nil {
+		return Manifest{}, err
+	}
+	_, err = archive.Write(content)
+	if err != nil {
+		return Manifest{}, err
+	}
+	err = archive.Close()
+	if err != nil {
+		return Manifest{}, err
+	}
+	return result, gz.Close()
+}
+
+// Import writes the content of an archive created by Export to the store.
+//
+// The full archive (checksums, keys and the manifest) is verified before the first key is written to the store,
+// therefore nothing is imported from corrupt or truncated archives. Readers which are not seekable are copied to a
+// temporary file for the verification.
+func Import(r io.Reader, to KV) (Manifest, error) {
+	seeker, seekable := r.(io.ReadSeeker)
+	start := int64(0)
+	if seekable {
+		var err error
+		start, err = seeker.Seek(0, io.SeekCurrent)
+		//pipes (like stdin) implement Seek but can't seek
+		seekable = err == nil
+	}
+	if !seekable {
+		spool, err := ioutil.TempFile("", "kv-import")
+		if err != nil {
+			return Manifest{}, err
+		}
+		defer os.Remove(spool.Name())
+		defer spool.Close()
+		_, err = io.Copy(spool, r)
+		if err != nil {
+			return Manifest{}, err
+		}
+		seeker, start = spool, 0
+	}
+	_, err := seeker.Seek(start, io.SeekStart)
+	if err != nil {
+		return Manifest{}, err
+	}
+	_, err = readArchive(seeker, nil)
+	if err != nil {
+		return Manifest{}, err
+	}
+	_, err = seeker.Seek(start, io.SeekStart)
+	if err != nil {
+		return Manifest{}, err
+	}
+	return readArchive(seeker, to)
+}
+
+// Verify checks the integrity of an archive without importing it.
+func Verify(r io.Reader) (Manifest, error) {
+	return readArchive(r, nil)
+}
+
+func readArchive(r io.Reader, to KV) (Manifest, error) {
+	gz, err := gzip.NewReader(r)
+	if err != nil {
+		return Manifest{}, err
+	}
+	defer gz.Close()
+	archive := tar.NewReader(gz)
+	actual := newManifestBuilder()
+	for {
+		header, err := archive.Next()
+		if err == io.EOF {
+			return Manifest{}, errors.New("Archive is truncated, manifest is missing")
+		}
+		if err != nil {
+			return Manifest{}, err
+		}
+		if header.Name == archiveManifestName {
+			return verifyManifest(archive, actual.build())
+		}
+		if header.Typeflag != tar.TypeReg || !strings.HasPrefix(header.Name, archiveDataPrefix) {
+			continue
+		}
+		key := header.Name[len(archiveDataPrefix):]
+		if !validArchiveKey(key) {
+			return Manifest{}, errors.New("Invalid key in the archive: " + key)
+		}
+		value, err := ioutil.ReadAll(archive)
+		if err != nil {
+			return Manifest{}, errors.Wrap(err, "Couldn't read the value of "+key)
+		}
+		checksum := sha256.Sum256(value)
+		checksumHex := hex.EncodeToString(checksum[:])
+		if expected := header.PAXRecords[archiveChecksumKey]; expected != checksumHex {
+			return Manifest{}, errors.New("Checksum mismatch for key " + key)
+		}
+		if to != nil {
+			err = to.Put(key, value)
+			if err != nil {
+				return Manifest{}, errors.Wrap(err, "Couldn't store key "+key)
+			}
+		}
+		actual.add(key, int64(len(value)), checksumHex)
+	}
+}
+
+// validArchiveKey returns false for the keys which could be stored outside of a directory based store.
+func validArchiveKey(key string) bool {
+	if key == "" || path.IsAbs(key) || path.Clean(key) != key {
+		return false
+	}
+	for _, segment := range strings.Split(key, "/") {
+		if segment == ".." {
+			return false
+		}
+	}
+	return true
+}
+
+func verifyManifest(r io.Reader, actual Manifest) (Manifest, error) {
+	manifest := Manifest{}
+	content, err := ioutil.ReadAll(r)
+	if err != nil {
+		return manifest, err
+	}
+	err = json.Unmarshal(content, &manifest)
+	if err != nil {
+		return manifest, errors.Wrap(err, "Manifest is invalid")
+	}
+	if manifest.Version != archiveFormatVersion {
+		return manifest, errors.New("Unsupported archive version " + strconv.Itoa(manifest.Version))
+	}
+	if manifest.Count != actual.Count {
+		return manifest, errors.New("Manifest has " + strconv.Itoa(manifest.Count) + " keys but archive contains " + strconv.Itoa(actual.Count))
+	}
+	if manifest.Bytes != actual.Bytes || manifest.Checksum != actual.Checksum {
+		return manifest, errors.New("Archive checksum doesn't match with the manifest")
+	}
+	return manifest, nil
+}
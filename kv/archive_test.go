@@ -0,0 +1,134 @@
+package kv
+
+import (
+	"archive/tar"
+	"bytes"
+	"compress/gzip"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"github.com/stretchr/testify/assert"
+	"io"
+	"os"
+	"sort"
+	"testing"
+)
+
+func TestExportImport(t *testing.T) {
+	_ = os.RemoveAll("/tmp/testx")
+	from := &DirKV{Path: "/tmp/testx"}
+	assert.Nil(t, from.Put("key1", []byte("value1")))
+	assert.Nil(t, from.Put("dir1/key2", []byte("value2")))
+	assert.Nil(t, from.Put("dir1/dir2/key3", []byte("value3")))
+
+	archive := bytes.Buffer{}
+	manifest, err := Export(from, &archive)
+	assert.Nil(t, err)
+	assert.Equal(t, 3, manifest.Count)
+	assert.Equal(t, int64(18), manifest.Bytes)
+
+	_ = os.Remove("/tmp/test")
+	to, err := CreateSqliteKV("/tmp/test")
+	assert.Nil(t, err)
+	defer to.Close()
+
+	imported, err := Import(bytes.NewReader(archive.Bytes()), to)
+	assert.Nil(t, err)
+	assert.Equal(t, manifest.Checksum, imported.Checksum)
+
+	value, err := to.Get("dir1/dir2/key3")
+	assert.Nil(t, err)
+	assert.Equal(t, []byte("value3"), value)
+}
+
+func TestVerifyTruncatedArchive(t *testing.T) {
+	_ = os.RemoveAll("/tmp/testx")
+	from := &DirKV{Path: "/tmp/testx"}
+	assert.Nil(t, from.Put("key1", []byte("value1")))
+
+	archive := bytes.Buffer{}
+	_, err := Export(from, &archive)
+	assert.Nil(t, err)
+
+	_, err = Verify(bytes.NewReader(archive.Bytes()))
+	assert.Nil(t, err)
+
+	_, err = Verify(bytes.NewReader(archive.Bytes()[:archive.Len()/2]))
+	assert.NotNil(t, err)
+}
+
+//writeArchive creates an archive with the given entries and a valid manifest
+func writeArchive(t *testing.T, entries map[string][]byte) []byte {
+	result := bytes.Buffer{}
+	gz := gzip.NewWriter(&result)
+	archive := tar.NewWriter(gz)
+	manifest := newManifestBuilder()
+	keys := make([]string, 0, len(entries))
+	for key := range entries {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	for _, key := range keys {
+		value := entries[key]
+		checksum := sha256.Sum256(value)
+		checksumHex := hex.EncodeToString(checksum[:])
+		assert.Nil(t, archive.WriteHeader(&tar.Header{
+			Typeflag:   tar.TypeReg,
+			Name:       archiveDataPrefix + key,
+			Size:       int64(len(value)),
+			Mode:       0644,
+			Format:     tar.FormatPAX,
+			PAXRecords: map[string]string{archiveChecksumKey: checksumHex},
+		}))
+		_, err := archive.Write(value)
+		assert.Nil(t, err)
+		manifest.add(key, int64(len(value)), checksumHex)
+	}
+	content, err := json.Marshal(manifest.build())
+	assert.Nil(t, err)
+	assert.Nil(t, archive.WriteHeader(&tar.Header{Typeflag: tar.TypeReg, Name: archiveManifestName, Size: int64(len(content)), Mode: 0644}))
+	_, err = archive.Write(content)
+	assert.Nil(t, err)
+	assert.Nil(t, archive.Close())
+	assert.Nil(t, gz.Close())
+	return result.Bytes()
+}
+
+func TestImportRejectsUnsafeKeys(t *testing.T) {
+	for _, key := range []string{"../escape/pwned", "dir1/../../escape/pwned", "/tmp/testescape/pwned", "dir1//key1", "dir1/./key1"} {
+		_ = os.RemoveAll("/tmp/testarchive")
+		_ = os.RemoveAll("/tmp/testescape")
+		to := &DirKV{Path: "/tmp/testarchive/store"}
+		content := writeArchive(t, map[string][]byte{"a/key0": []byte("value0"), key: []byte("pwned")})
+
+		_, err := Import(bytes.NewReader(content), to)
+		assert.NotNil(t, err, key)
+
+		//nothing is written, even the valid keys before the invalid one
+		_, err = os.Stat("/tmp/testarchive")
+		assert.True(t, os.IsNotExist(err), key)
+		_, err = os.Stat("/tmp/testescape")
+		assert.True(t, os.IsNotExist(err), key)
+	}
+}
+
+func TestImportVerifiesArchiveFirst(t *testing.T) {
+	from := CreateMemoryKV()
+	assert.Nil(t, from.Put("key1", bytes.Repeat([]byte("value1"), 1000)))
+	assert.Nil(t, from.Put("key2", []byte("value2")))
+	archive := bytes.Buffer{}
+	_, err := Export(from, &archive)
+	assert.Nil(t, err)
+
+	//the first value is readable, but the manifest is missing (the reader is not seekable)
+	to := CreateMemoryKV()
+	_, err = Import(io.MultiReader(bytes.NewReader(archive.Bytes()[:archive.Len()-30])), to)
+	assert.NotNil(t, err)
+	keys, err := to.List("")
+	assert.Nil(t, err)
+	assert.Equal(t, 0, len(keys))
+
+	_, err = Import(io.MultiReader(bytes.NewReader(archive.Bytes())), to)
+	assert.Nil(t, err)
+	assert.True(t, to.Contains("key2"))
+}
@@ -0,0 +1,60 @@
+package kv
+
+import (
+	"encoding/json"
+	"sort"
+)
+
+// Problem is an integrity problem found by Check.
+type Problem struct {
+	Key         string
+	Description string
+	Repaired    bool
+}
+
+type CheckOptions struct {
+	// Repair fixes the problems where it's possible.
+	Repair bool
+	// Json reports the values which are not valid JSON documents.
+	Json bool
+}
+
+// Checker is implemented by the stores which have backend specific invariants.
+type Checker interface {
+	// Check verifies the invariants of the backend and fixes the problems if repair is true.
+	Check(repair bool) ([]Problem, error)
+}
+
+// Check verifies the integrity of a store: runs the backend specific checks (if the store is a Checker) and reads all
+// the values.
+func Check(store KV, options CheckOptions) ([]Problem, error) {
+	problems := make([]Problem, 0)
+	if checker, ok := store.(Checker); ok {
+		backendProblems, err := checker.Check(options.Repair)
+		if err != nil {
+			return problems, err
+		}
+		problems = append(problems, backendProblems...)
+	}
+	err := store.IterateAll(func(key string) error {
+		value, err := store.Get(key)
+		if err != nil {
+			problems = append(problems, Problem{Key: key, Description: "value is unreadable: " + err.Error()})
+			return nil
+		}
+		if options.Json && !json.Valid(value) {
+			problems = append(problems, Problem{Key: key, Description: "value is not a valid JSON document"})
+		}
+		return nil
+	})
+	return problems, err
+}
+
+func sortedKeys(set map[string]bool) []string {
+	result := make([]string, 0, len(set))
+	for key := range set {
+		result = append(result, key)
+	}
+	sort.Strings(result)
+	return result
+}
@@ -0,0 +1,112 @@
+package kv
+
+import (
+	"github.com/stretchr/testify/assert"
+	"io/ioutil"
+	"os"
+	"testing"
+)
+
+func TestCheckSqlitePrefixes(t *testing.T) {
+	os.Remove("/tmp/test")
+	kv, err := CreateSqliteKV("/tmp/test")
+	assert.Nil(t, err)
+	defer kv.Close()
+
+	assert.Nil(t, kv.Put("dir1/dir2/key1", []byte("{}")))
+	assert.Nil(t, kv.Put("dir3/key1", []byte("value")))
+	assert.Nil(t, kv.ExecQuery("DELETE FROM prefix WHERE key = ?", "dir2"))
+	assert.Nil(t, kv.ExecQuery("DELETE FROM key WHERE prefix = ?", "dir3"))
+
+	problems, err := Check(kv, CheckOptions{Repair: true, Json: true})
+	assert.Nil(t, err)
+	assert.Equal(t, []Problem{
+		{Key: "dir1/dir2", Description: "prefix of stored keys is missing from the prefix table", Repaired: true},
+		{Key: "dir3", Description: "prefix doesn't have any key", Repaired: true},
+	}, problems)
+
+	keys, err := kv.List("dir1")
+	assert.Nil(t, err)
+	assert.Equal(t, []string{"dir1/dir2"}, keys)
+
+	problems, err = Check(kv, CheckOptions{Json: true})
+	assert.Nil(t, err)
+	assert.Empty(t, problems)
+}
+
+func TestCheckAfterDelete(t *testing.T) {
+	os.Remove("/tmp/test")
+	kv, err := CreateSqliteKV("/tmp/test")
+	assert.Nil(t, err)
+	defer kv.Close()
+
+	assert.Nil(t, kv.Put("dir1/dir2/key1", []byte("value")))
+	assert.Nil(t, kv.Put("dir1/key2", []byte("value")))
+	assert.Nil(t, kv.Put("dir3/key1", []byte("value")))
+	assert.Nil(t, kv.Delete("dir1/dir2/key1"))
+	assert.Nil(t, kv.Delete("dir3/key1"))
+
+	problems, err := Check(kv, CheckOptions{})
+	assert.Nil(t, err)
+	assert.Empty(t, problems)
+
+	keys, err := kv.List("")
+	assert.Nil(t, err)
+	assert.Equal(t, []string{"dir1"}, keys)
+	keys, err = kv.List("dir1")
+	assert.Nil(t, err)
+	assert.Equal(t, []string{"dir1/key2"}, keys)
+
+	//pruned prefixes are created again
+	assert.Nil(t, kv.Put("dir3/key1", []byte("value")))
+	keys, err = kv.List("")
+	assert.Nil(t, err)
+	assert.Equal(t, []string{"dir1", "dir3"}, keys)
+}
+
+func TestCheckDir(t *testing.T) {
+	_ = os.RemoveAll("/tmp/testx")
+	kv := &DirKV{Path: "/tmp/testx"}
+	assert.Nil(t, kv.Put("dir1/key1", []byte("value")))
+	assert.Nil(t, ioutil.WriteFile("/tmp/testx/dir1/.key2"+dirTempSuffix+"123", []byte("val"), 0644))
+
+	problems, err := Check(kv, CheckOptions{Repair: true, Json: true})
+	assert.Nil(t, err)
+	assert.Equal(t, []Problem{
+		{Key: "dir1/.key2" + dirTempSuffix + "123", Description: "orphan temporary file", Repaired: true},
+		{Key: "dir1/key1", Description: "value is not a valid JSON document"},
+	}, problems)
+	assert.False(t, kv.Contains("dir1/.key2"+dirTempSuffix+"123"))
+
+	//empty values are valid
+	assert.Nil(t, kv.Put("dir1/key1", []byte{}))
+	problems, err = Check(kv, CheckOptions{})
+	assert.Nil(t, err)
+	assert.Empty(t, problems)
+}
+
+func TestCheckDirRelativePath(t *testing.T) {
+	_ = os.RemoveAll("/tmp/testrel")
+	assert.Nil(t, os.MkdirAll("/tmp/testrel/store", 0755))
+	cwd, err := os.Getwd()
+	assert.Nil(t, err)
+	assert.Nil(t, os.Chdir("/tmp/testrel/store"))
+	defer os.Chdir(cwd)
+
+	kv := &DirKV{Path: "."}
+	assert.Nil(t, kv.Put("dir1/key1", []byte("{}")))
+	assert.Nil(t, ioutil.WriteFile("dir1/.key2"+dirTempSuffix+"123", []byte("val"), 0644))
+
+	problems, err := kv.Check(true)
+	assert.Nil(t, err)
+	assert.Equal(t, []Problem{
+		{Key: "dir1/.key2" + dirTempSuffix + "123", Description: "orphan temporary file", Repaired: true},
+	}, problems)
+
+	keys := make([]string, 0)
+	assert.Nil(t, kv.IterateAll(func(key string) error {
+		keys = append(keys, key)
+		return nil
+	}))
+	assert.Equal(t, []string{"dir1/key1"}, keys)
+}
@@ -0,0 +1,63 @@
+package kv
+
+import (
+	"bytes"
+	"github.com/pkg/errors"
+	"strings"
+)
+
+type DifferenceType string
+
+const (
+	OnlyInFirst  DifferenceType = "only-in-first"
+	OnlyInSecond DifferenceType = "only-in-second"
+	Different    DifferenceType = "different"
+)
+
+// Difference is a key which is missing from one of the compared stores or has different values.
+type Difference struct {
+	Key  string
+	Type DifferenceType
+	// First is the value from the first store (nil if missing)
+	First []byte
+	// Second is the value from the second store (nil if missing)
+	Second []byte
+}
+
+// Compare calls the action for each key (under the prefix, see IterateSubTree) which is missing from one of the stores or
+// has different values in the two stores.
+func Compare(first KV, second KV, prefix string, action func(diff Difference) error) error {
+	prefix = strings.TrimSuffix(prefix, "/")
+	firstKeys := make(map[string]bool)
+	err := first.IterateSubTree(prefix, func(key string) error {
+		firstKeys[key] = true
+		value, err := first.Get(key)
+		if err != nil {
+			return errors.Wrap(err, "Couldn't read key "+key)
+		}
+		if !second.Contains(key) {
+			return action(Difference{Key: key, Type: OnlyInFirst, First: value})
+		}
+		other, err := second.Get(key)
+		if err != nil {
+			return errors.Wrap(err, "Couldn't read key "+key)
+		}
+		if !bytes.Equal(value, other) {
+			return action(Difference{Key: key, Type: Different, First: value, Second: other})
+		}
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+	return second.IterateSubTree(prefix, func(key string) error {
+		if firstKeys[key] {
+			return nil
+		}
+		value, err := second.Get(key)
+		if err != nil {
+			return errors.Wrap(err, "Couldn't read key "+key)
+		}
+		return action(Difference{Key: key, Type: OnlyInSecond, Second: value})
+	})
+}
@@ -0,0 +1,38 @@
+package kv
+
+import (
+	"github.com/stretchr/testify/assert"
+	"os"
+	"sort"
+	"testing"
+)
+
+func TestCompare(t *testing.T) {
+	_ = os.RemoveAll("/tmp/testx")
+	first := &DirKV{Path: "/tmp/testx"}
+	assert.Nil(t, first.Put("dir1/key1", []byte("value1")))
+	assert.Nil(t, first.Put("dir1/key2", []byte("value2")))
+
+	_ = os.Remove("/tmp/test")
+	second, err := CreateSqliteKV("/tmp/test")
+	assert.Nil(t, err)
+	defer second.Close()
+	assert.Nil(t, second.Put("dir1/key1", []byte("value1")))
+	assert.Nil(t, second.Put("dir1/key2", []byte("old")))
+	assert.Nil(t, second.Put("dir1/key3", []byte("value3")))
+	assert.Nil(t, first.Put("dir2/key1", []byte("value1")))
+	//not under the dir1 prefix
+	assert.Nil(t, first.Put("dir10/key1", []byte("value1")))
+	assert.Nil(t, second.Put("dir10/key2", []byte("value2")))
+
+	for _, prefix := range []string{"dir1", "dir1/"} {
+		differences := make([]string, 0)
+		err = Compare(first, second, prefix, func(diff Difference) error {
+			differences = append(differences, string(diff.Type)+" "+diff.Key)
+			return nil
+		})
+		assert.Nil(t, err)
+		sort.Strings(differences)
+		assert.Equal(t, []string{"different dir1/key2", "only-in-second dir1/key3"}, differences, prefix)
+	}
+}
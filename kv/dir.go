@@ -6,18 +6,80 @@ import (
 	"os"
 	"path"
 	"path/filepath"
+	"strings"
 	"time"
 )
 
 type DirKV struct {
 	Path string
+	//FileMode and DirMode are the permissions of the created files and directories (0644 and 0755 if not set)
+	FileMode os.FileMode
+	DirMode  os.FileMode
 }
 
+//suffix of the temporary files used during the writes
+const dirTempSuffix = ".kvtmp"
 
+func isTempFile(name string) bool {
+	return strings.HasPrefix(name, ".") && strings.Contains(name, dirTempSuffix)
+}
+
+func (dir *DirKV) fileMode() os.FileMode {
+	if dir.FileMode == 0 {
+		return 0644
+	}
+	return dir.FileMode
+}
+
+func (dir *DirKV) dirMode() os.FileMode {
+	if dir.DirMode == 0 {
+		return 0755
+	}
+	return dir.DirMode
+}
+
+//Put writes the value to a temporary file and renames it, to keep hard-linked snapshots untouched.
 func (dir *DirKV) Put(key string, value []byte) error {
 	file := path.Join(dir.Path, key)
-	_ = os.MkdirAll(path.Dir(file), 0755)
-	return ioutil.WriteFile(file, value, 0644)
+	_ = os.MkdirAll(path.Dir(file), dir.dirMode())
+	tmp, err := ioutil.TempFile(path.Dir(file), "."+path.Base(file)+dirTempSuffix+"*")
+	if err != nil {
+		return err
+	}
+	_, err = tmp.Write(value)
+	if err == nil {
+		err = tmp.Chmod(dir.fileMode())
+	}
+	if closeErr := tmp.Close(); err == nil {
+		err = closeErr
+	}
+	if err == nil {
+		err = os.Rename(tmp.Name(), file)
+	}
+	if err != nil {
+		_ = os.Remove(tmp.Name())
+		return err
+	}
+	return nil
+}
+
+func (dir *DirKV) Delete(key string) error {
+	file := path.Join(dir.Path, key)
+	err := os.Remove(file)
+	if os.IsNotExist(err) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	//remove the empty parent directories
+	root := path.Clean(dir.Path)
+	for parent := path.Dir(file); parent != root && len(parent) > len(root); parent = path.Dir(parent) {
+		if os.Remove(parent) != nil {
+			break
+		}
+	}
+	return nil
 }
 
 func (dir *DirKV) List(prefix string) ([]string, error) {
@@ -29,6 +91,9 @@ func (dir *DirKV) List(prefix string) ([]string, error) {
 
 	result := make([]string, 0)
 	for _, fileInfo := range fileInfos {
+		if isTempFile(fileInfo.Name()) {
+			continue
+		}
 		result = append(result, path.Join(prefix, fileInfo.Name()))
 	}
 	return result, nil
@@ -89,6 +154,9 @@ func (dir *DirKV) IterateValues(prefix string, action KeyValueIteratorAction) er
 		return nil
 	}
 	for _, file := range files {
+		if file.IsDir() || isTempFile(file.Name()) {
+			continue
+		}
 		value, err := dir.Get(path.Join(prefix, file.Name()))
 		if err != nil {
 			return err
@@ -107,6 +175,9 @@ func (dir *DirKV) Iterate(prefix string, action IteratorAction) error {
 		return err
 	}
 	for _, file := range files {
+		if isTempFile(file.Name()) {
+			continue
+		}
 		err = action(path.Join(prefix, file.Name()))
 		if err != nil {
 			return err
@@ -116,18 +187,131 @@ func (dir *DirKV) Iterate(prefix string, action IteratorAction) error {
 }
 
 func (dir *DirKV) IterateSubTree(prefix string, action IteratorAction) error {
-	return filepath.Walk(path.Join(dir.Path, prefix),
+	root := filepath.Clean(dir.Path)
+	return filepath.Walk(filepath.Join(root, prefix),
 		func(path string, info os.FileInfo, err error) error {
 			if err != nil {
 				return err
 			}
-			if dir.Path == path || info.IsDir() {
+			if info.IsDir() || isTempFile(info.Name()) {
 				return nil
 			}
-			return action(path[len(dir.Path)+1:])
+			key, err := filepath.Rel(root, path)
+			if err != nil {
+				return err
+			}
+			return action(filepath.ToSlash(key))
 		})
 }
 
 func (dir *DirKV) Close() error {
 	return nil
 }
+
+// Snapshot hard-links the files of the store to a sibling directory. As Put replaces the files instead of
+// rewriting them, the linked files are not changed by later writes. Files are copied if linking is not possible.
+func (dir *DirKV) Snapshot() (Reader, error) {
+	//relative paths (like ".") don't have a parent directory
+	root, err := filepath.Abs(dir.Path)
+	if err != nil {
+		return nil, err
+	}
+	snapshotDir, err := ioutil.TempDir(filepath.Dir(root), "."+filepath.Base(root)+".snapshot")
+	if err != nil {
+		return nil, err
+	}
+	err = filepath.Walk(root, func(file string, info os.FileInfo, err error) error {
+		if err != nil {
+			if os.IsNotExist(err) && file == root {
+				return nil
+			}
+			return err
+		}
+		if file == root || isTempFile(info.Name()) {
+			return nil
+		}
+		relative, err := filepath.Rel(root, file)
+		if err != nil {
+			return err
+		}
+		target := filepath.Join(snapshotDir, relative)
+		if info.IsDir() {
+			return os.MkdirAll(target, dir.dirMode())
+		}
+		if os.Link(file, target) == nil {
+			return nil
+		}
+		return copyFile(file, target, dir.fileMode())
+	})
+	if err != nil {
+		_ = os.RemoveAll(snapshotDir)
+		return nil, err
+	}
+	return &snapshot{
+		store: &DirKV{
+			Path: snapshotDir,
+		},
+		release: func() error {
+			return os.RemoveAll(snapshotDir)
+		},
+	}, nil
+}
+
+func copyFile(from string, to string, mode os.FileMode) error {
+	source, err := os.Open(from)
+	if err != nil {
+		return err
+	}
+	defer source.Close()
+	target, err := os.OpenFile(to, os.O_WRONLY|os.O_CREATE|os.O_TRUNC, mode)
+	if err != nil {
+		return err
+	}
+	_, err = io.Copy(target, source)
+	if closeErr := target.Close(); err == nil {
+		err = closeErr
+	}
+	return err
+}
+
+// Check reports (and removes with repair) the temporary files of interrupted writes and reports the entries which are
+// not regular files.
+func (dir *DirKV) Check(repair bool) ([]Problem, error) {
+	problems := make([]Problem, 0)
+	//relative paths (like ".") are not prefixes of the walked paths
+	root, err := filepath.Abs(dir.Path)
+	if err != nil {
+		return nil, err
+	}
+	err = filepath.Walk(root, func(file string, info os.FileInfo, err error) error {
+		if err != nil {
+			if os.IsNotExist(err) && file == root {
+				return nil
+			}
+			return err
+		}
+		if file == root || info.IsDir() {
+			return nil
+		}
+		key, err := filepath.Rel(root, file)
+		if err != nil {
+			return err
+		}
+		key = filepath.ToSlash(key)
+		if isTempFile(info.Name()) {
+			problem := Problem{Key: key, Description: "orphan temporary file"}
+			if repair {
+				err = os.Remove(file)
+				if err != nil {
+					return err
+				}
+				problem.Repaired = true
+			}
+			problems = append(problems, problem)
+		} else if !info.Mode().IsRegular() {
+			problems = append(problems, Problem{Key: key, Description: "not a regular file"})
+		}
+		return nil
+	})
+	return problems, err
+}
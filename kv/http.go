@@ -0,0 +1,324 @@
+package kv
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"github.com/pkg/errors"
+	"github.com/rs/zerolog/log"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+)
+
+// NewHandler exposes a store over HTTP with the following REST API:
+//
+//	GET/PUT/DELETE/HEAD /kv/<key>      read, write, delete or check a key
+//	GET /list/<prefix>                 JSON list of the keys and sub-prefixes under the prefix (see KV.List)
+//	GET /iterate/<prefix>              JSON Lines records (see NewExactRecord) of all the keys under the prefix. With
+//	                                   shallow=true only the keys directly under the prefix are returned, with
+//	                                   values=false the values are omitted.
+//	GET /changed/<key>?since=<time>    JSON boolean, the result of KV.IsChanged (time is in RFC3339 format)
+func NewHandler(store KV) http.Handler {
+	mux := http.NewServeMux()
+	mux.HandleFunc("/kv/", func(w http.ResponseWriter, r *http.Request) {
+		key := strings.TrimPrefix(r.URL.Path, "/kv/")
+		switch r.Method {
+		case http.MethodGet, http.MethodHead:
+			if !store.Contains(key) {
+				http.Error(w, "No such key "+key, http.StatusNotFound)
+				return
+			}
+			if r.Method == http.MethodHead {
+				return
+			}
+			value, err := store.Get(key)
+			if err != nil {
+				writeHttpError(w, err)
+				return
+			}
+			w.Header().Set("Content-Type", "application/octet-stream")
+			_, _ = w.Write(value)
+		case http.MethodPut:
+			value, err := ioutil.ReadAll(r.Body)
+			if err == nil {
+				err = store.Put(key, value)
+			}
+			if err != nil {
+				writeHttpError(w, err)
+				return
+			}
+			w.WriteHeader(http.StatusNoContent)
+		case http.MethodDelete:
+			err := store.Delete(key)
+			if err != nil {
+				writeHttpError(w, err)
+				return
+			}
+			w.WriteHeader(http.StatusNoContent)
+		default:
+			http.Error(w, "Unsupported method "+r.Method, http.StatusMethodNotAllowed)
+		}
+	})
+	mux.HandleFunc("/list/", func(w http.ResponseWriter, r *http.Request) {
+		keys, err := store.List(strings.TrimPrefix(r.URL.Path, "/list/"))
+		if err != nil {
+			writeHttpError(w, err)
+			return
+		}
+		w.Header().Set("Content-Type", "application/json")
+		_ = json.NewEncoder(w).Encode(keys)
+	})
+	mux.HandleFunc("/iterate/", func(w http.ResponseWriter, r *http.Request) {
+		prefix := strings.TrimPrefix(r.URL.Path, "/iterate/")
+		withValues := r.URL.Query().Get("values") != "false"
+		w.Header().Set("Content-Type", "application/x-ndjson")
+		encoder := newRecordEncoder(w)
+		write := func(key string, value []byte) error {
+			record := Record{Key: key}
+			if withValues {
+				var err error
+				record, err = NewExactRecord(key, value)
+				if err != nil {
+					return err
+				}
+			}
+			return encoder.Encode(record)
+		}
+		var err error
+		if r.URL.Query().Get("shallow") == "true" {
+			err = store.IterateValues(prefix, write)
+		} else {
+			err = store.IterateSubTree(prefix, func(key string) error {
+				var value []byte
+				if withValues {
+					var err error
+					value, err = store.Get(key)
+					if err != nil {
+						return err
+					}
+				}
+				return write(key, value)
+			})
+		}
+		if err != nil {
+			//the status is already sent, the client detects the missing records by the broken stream
+			log.Error().Err(err).Msgf("Iteration of %s is failed", prefix)
+			panic(http.ErrAbortHandler)
+		}
+	})
+	mux.HandleFunc("/changed/", func(w http.ResponseWriter, r *http.Request) {
+		since, err := time.Parse(time.RFC3339Nano, r.URL.Query().Get("since"))
+		if err != nil {
+			http.Error(w, "Invalid since parameter: "+err.Error(), http.StatusBadRequest)
+			return
+		}
+		changed, err := store.IsChanged(since, strings.TrimPrefix(r.URL.Path, "/changed/"))
+		if err != nil {
+			writeHttpError(w, err)
+			return
+		}
+		w.Header().Set("Content-Type", "application/json")
+		_ = json.NewEncoder(w).Encode(changed)
+	})
+	return mux
+}
+
+// NewReadOnlyHandler is the same as NewHandler, but it rejects the requests which would modify the store.
+func NewReadOnlyHandler(store KV) http.Handler {
+	handler := NewHandler(store)
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodGet && r.Method != http.MethodHead {
+			http.Error(w, "Store is read-only", http.StatusForbidden)
+			return
+		}
+		handler.ServeHTTP(w, r)
+	})
+}
+
+func writeHttpError(w http.ResponseWriter, err error) {
+	http.Error(w, err.Error(), http.StatusInternalServerError)
+}
+
+// HttpKV is a client of a store exposed with NewHandler.
+type HttpKV struct {
+	Url    string
+	Client *http.Client
+}
+
+func CreateHttpKV(url string) *HttpKV {
+	return &HttpKV{
+		Url:    strings.TrimSuffix(url, "/"),
+		Client: &http.Client{},
+	}
+}
+
+func (h *HttpKV) url(endpoint string, key string, params url.Values) string {
+	segments := strings.Split(key, "/")
+	for i, segment := range segments {
+		segments[i] = url.PathEscape(segment)
+	}
+	result := h.Url + "/" + endpoint + "/" + strings.Join(segments, "/")
+	if len(params) > 0 {
+		result += "?" + params.Encode()
+	}
+	return result
+}
+
+//call executes the request and returns the response if the status code is 2xx
+func (h *HttpKV) call(method string, url string, body []byte) (*http.Response, error) {
+	req, err := http.NewRequest(method, url, bytes.NewReader(body))
+	if err != nil {
+		return nil, err
+	}
+	resp, err := h.Client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	if resp.StatusCode > 299 {
+		defer resp.Body.Close()
+		message, _ := ioutil.ReadAll(resp.Body)
+		return resp, errors.New(method + " " + url + " is failed (" + resp.Status + "): " + strings.TrimSpace(string(message)))
+	}
+	return resp, nil
+}
+
+func (h *HttpKV) read(method string, url string) ([]byte, error) {
+	resp, err := h.call(method, url, nil)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	return ioutil.ReadAll(resp.Body)
+}
+
+func (h *HttpKV) Put(key string, value []byte) error {
+	resp, err := h.call(http.MethodPut, h.url("kv", key, nil), value)
+	if err != nil {
+		return err
+	}
+	return resp.Body.Close()
+}
+
+func (h *HttpKV) Delete(key string) error {
+	_, err := h.read(http.MethodDelete, h.url("kv", key, nil))
+	return err
+}
+
+func (h *HttpKV) List(prefix string) ([]string, error) {
+	content, err := h.read(http.MethodGet, h.url("list", prefix, nil))
+	if err != nil {
+		return nil, err
+	}
+	result := make([]string, 0)
+	err = json.Unmarshal(content, &result)
+	return result, err
+}
+
+func (h *HttpKV) IterateAll(action IteratorAction) error {
+	return h.IterateSubTree("", action)
+}
+
+func (h *HttpKV) Iterate(prefix string, action IteratorAction) error {
+	keys, err := h.List(prefix)
+	if err != nil {
+		return err
+	}
+	for _, key := range keys {
+		err = action(key)
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (h *HttpKV) IterateValues(prefix string, action KeyValueIteratorAction) error {
+	return h.iterate(h.url("iterate", prefix, url.Values{"shallow": {"true"}}), func(record Record) error {
+		value, err := record.Bytes()
+		if err != nil {
+			return err
+		}
+		return action(record.Key, value)
+	})
+}
+
+func (h *HttpKV) IterateSubTree(prefix string, action IteratorAction) error {
+	return h.iterate(h.url("iterate", prefix, url.Values{"values": {"false"}}), func(record Record) error {
+		return action(record.Key)
+	})
+}
+
+//iterate streams the JSON Lines records of an iterate call
+func (h *HttpKV) iterate(url string, action func(record Record) error) error {
+	resp, err := h.call(http.MethodGet, url, nil)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	decoder := json.NewDecoder(bufio.NewReader(resp.Body))
+	for {
+		record := Record{}
+		err = decoder.Decode(&record)
+		if err == io.EOF {
+			return nil
+		}
+		if err != nil {
+			return errors.Wrap(err, "Iteration is failed")
+		}
+		err = action(record)
+		if err != nil {
+			return err
+		}
+	}
+}
+
+func (h *HttpKV) Contains(key string) bool {
+	_, err := h.read(http.MethodHead, h.url("kv", key, nil))
+	return err == nil
+}
+
+func (h *HttpKV) GetOrDefault(key string, defaultFunc Getter) ([]byte, error) {
+	if !h.Contains(key) {
+		val, err := defaultFunc(key)
+		if err != nil {
+			return nil, err
+		}
+		err = h.Put(key, val)
+		if err != nil {
+			return nil, err
+		}
+		return val, nil
+	}
+	return h.Get(key)
+}
+
+func (h *HttpKV) Get(key string) ([]byte, error) {
+	return h.read(http.MethodGet, h.url("kv", key, nil))
+}
+
+// GetReader streams the value from the server. The returned reader is an io.ReadCloser which should be closed.
+func (h *HttpKV) GetReader(key string) (io.Reader, error) {
+	resp, err := h.call(http.MethodGet, h.url("kv", key, nil), nil)
+	if err != nil {
+		return nil, err
+	}
+	return resp.Body, nil
+}
+
+func (h *HttpKV) IsChanged(since time.Time, key string) (bool, error) {
+	content, err := h.read(http.MethodGet, h.url("changed", key, url.Values{"since": {since.Format(time.RFC3339Nano)}}))
+	if err != nil {
+		return true, err
+	}
+	changed := true
+	err = json.Unmarshal(content, &changed)
+	return changed, err
+}
+
+func (h *HttpKV) Close() error {
+	return nil
+}
@@ -0,0 +1,87 @@
+package kv
+
+import (
+	"github.com/stretchr/testify/assert"
+	"io/ioutil"
+	"net/http/httptest"
+	"os"
+	"sort"
+	"testing"
+	"time"
+)
+
+func TestHttpKV(t *testing.T) {
+	_ = os.RemoveAll("/tmp/testx")
+	server := httptest.NewServer(NewHandler(&DirKV{Path: "/tmp/testx"}))
+	defer server.Close()
+
+	store, err := Create(server.URL)
+	assert.Nil(t, err)
+
+	assert.Nil(t, store.Put("key1", []byte("value1")))
+	assert.Nil(t, store.Put("dir1/key1", []byte("{\"a\":1}")))
+	assert.Nil(t, store.Put("dir1/dir2/key 2", []byte{0, 1}))
+
+	value, err := store.Get("dir1/dir2/key 2")
+	assert.Nil(t, err)
+	assert.Equal(t, []byte{0, 1}, value)
+
+	reader, err := store.GetReader("key1")
+	assert.Nil(t, err)
+	value, err = ioutil.ReadAll(reader)
+	assert.Nil(t, err)
+	assert.Equal(t, []byte("value1"), value)
+
+	assert.True(t, store.Contains("dir1/key1"))
+	assert.False(t, store.Contains("dir1/key2"))
+	_, err = store.Get("dir1/key2")
+	assert.NotNil(t, err)
+
+	list, err := store.List("dir1")
+	assert.Nil(t, err)
+	sort.Strings(list)
+	assert.Equal(t, []string{"dir1/dir2", "dir1/key1"}, list)
+
+	keys := make([]string, 0)
+	err = store.IterateAll(func(key string) error {
+		keys = append(keys, key)
+		return nil
+	})
+	assert.Nil(t, err)
+	sort.Strings(keys)
+	assert.Equal(t, []string{"dir1/dir2/key 2", "dir1/key1", "key1"}, keys)
+
+	values := make([]string, 0)
+	err = store.IterateValues("dir1", func(key string, value []byte) error {
+		values = append(values, key+"="+string(value))
+		return nil
+	})
+	assert.Nil(t, err)
+	assert.Equal(t, []string{"dir1/key1={\"a\":1}"}, values)
+
+	changed, err := store.IsChanged(time.Now().Add(time.Hour), "key1")
+	assert.Nil(t, err)
+	assert.False(t, changed)
+
+	assert.Nil(t, store.Delete("key1"))
+	assert.False(t, store.Contains("key1"))
+}
+
+func TestReadOnlyHttpKV(t *testing.T) {
+	backend := CreateMemoryKV()
+	assert.Nil(t, backend.Put("key1", []byte("value1")))
+	server := httptest.NewServer(NewReadOnlyHandler(backend))
+	defer server.Close()
+
+	store, err := Create(server.URL)
+	assert.Nil(t, err)
+
+	value, err := store.Get("key1")
+	assert.Nil(t, err)
+	assert.Equal(t, []byte("value1"), value)
+
+	assert.NotNil(t, store.Put("key2", []byte("value2")))
+	assert.NotNil(t, store.Delete("key1"))
+	assert.True(t, backend.Contains("key1"))
+	assert.False(t, backend.Contains("key2"))
+}
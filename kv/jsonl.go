@@ -0,0 +1,154 @@
+package kv
+
+import (
+	"bytes"
+	"encoding/base64"
+	"encoding/json"
+	"github.com/pkg/errors"
+	"io"
+	"strings"
+)
+
+// Record is one line of the JSON Lines representation of a store.
+//
+// Values which are valid JSON documents are embedded (compacted to one line), other values are stored as base64 encoded
+// JSON strings with the "base64" encoding:
+//
+//	{"key":"issues/HDDS-1","value":{"id":"1"}}
+//	{"key":"binary","value":"AAEC","encoding":"base64"}
+//
+// Embedded values lose their original formatting, records created by NewExactRecord restore exactly the same bytes.
+type Record struct {
+	Key      string          `json:"key"`
+	Value    json.RawMessage `json:"value"`
+	Encoding string          `json:"encoding,omitempty"`
+}
+
+const base64Encoding = "base64"
+
+// NewRecord creates the JSON Lines record of a key/value pair.
+func NewRecord(key string, value []byte) (Record, error) {
+	if json.Valid(value) {
+		return Record{Key: key, Value: value}, nil
+	}
+	return newBase64Record(key, value)
+}
+
+// NewExactRecord creates a record which restores exactly the same bytes: only the compact JSON values are embedded,
+// any other value (including indented JSON) is base64 encoded.
+func NewExactRecord(key string, value []byte) (Record, error) {
+	if json.Valid(value) {
+		compacted := bytes.Buffer{}
+		err := json.Compact(&compacted, value)
+		if err != nil {
+			return Record{}, err
+		}
+		if bytes.Equal(compacted.Bytes(), value) {
+			return Record{Key: key, Value: value}, nil
+		}
+	}
+	return newBase64Record(key, value)
+}
+
+func newBase64Record(key string, value []byte) (Record, error) {
+	encoded, err := json.Marshal(base64.StdEncoding.EncodeToString(value))
+	if err != nil {
+		return Record{}, err
+	}
+	return Record{Key: key, Value: encoded, Encoding: base64Encoding}, nil
+}
+
+// Bytes returns the raw value of the record.
+func (r Record) Bytes() ([]byte, error) {
+	switch r.Encoding {
+	case "":
+		return []byte(r.Value), nil
+	case base64Encoding:
+		var encoded string
+		err := json.Unmarshal(r.Value, &encoded)
+		if err != nil {
+			return nil, err
+		}
+		return base64.StdEncoding.DecodeString(encoded)
+	default:
+		return nil, errors.New("Unknown value encoding " + r.Encoding)
+	}
+}
+
+// newRecordEncoder returns an encoder which doesn't escape the HTML characters of the embedded values.
+func newRecordEncoder(w io.Writer) *json.Encoder {
+	encoder := json.NewEncoder(w)
+	encoder.SetEscapeHTML(false)
+	return encoder
+}
+
+// DumpJsonLines writes the keys of the store (or only the keys starting with one of the prefixes) as JSON Lines. With
+// exact, the records are created by NewExactRecord instead of NewRecord.
+func DumpJsonLines(from KV, w io.Writer, exact bool, prefixes ...string) (int, error) {
+	newRecord := NewRecord
+	if exact {
+		newRecord = NewExactRecord
+	}
+	encoder := newRecordEncoder(w)
+	counter := 0
+	err := from.IterateAll(func(key string) error {
+		if !hasAnyPrefix(key, prefixes) {
+			return nil
+		}
+		value, err := from.Get(key)
+		if err != nil {
+			return errors.Wrap(err, "Couldn't read key "+key)
+		}
+		record, err := newRecord(key, value)
+		if err != nil {
+			return err
+		}
+		counter++
+		return encoder.Encode(record)
+	})
+	return counter, err
+}
+
+// LoadJsonLines reads the JSON Lines records (as written by DumpJsonLines) and stores them. If prefixes are defined,
+// only the keys starting with one of them are stored.
+func LoadJsonLines(r io.Reader, to KV, prefixes ...string) (int, error) {
+	decoder := json.NewDecoder(r)
+	counter := 0
+	for {
+		record := Record{}
+		err := decoder.Decode(&record)
+		if err == io.EOF {
+			return counter, nil
+		}
+		if err != nil {
+			return counter, errors.Wrap(err, "Invalid JSON Lines record")
+		}
+		if record.Key == "" {
+			return counter, errors.New("Record without key")
+		}
+		if !hasAnyPrefix(record.Key, prefixes) {
+			continue
+		}
+		value, err := record.Bytes()
+		if err != nil {
+			return counter, errors.Wrap(err, "Invalid value for key "+record.Key)
+		}
+		err = to.Put(record.Key, value)
+		if err != nil {
+			return counter, err
+		}
+		counter++
+	}
+}
+
+func hasAnyPrefix(key string, prefixes []string) bool {
+	if len(prefixes) == 0 {
+		return true
+	}
+	for _, prefix := range prefixes {
+		if strings.HasPrefix(key, prefix) {
+			return true
+		}
+	}
+	return false
+}
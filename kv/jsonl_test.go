@@ -0,0 +1,106 @@
+package kv
+
+import (
+	"bytes"
+	"encoding/json"
+	"github.com/stretchr/testify/assert"
+	"os"
+	"sort"
+	"strings"
+	"testing"
+)
+
+func TestDumpLoadJsonLines(t *testing.T) {
+	_ = os.RemoveAll("/tmp/testx")
+	from := &DirKV{Path: "/tmp/testx"}
+	values := map[string][]byte{
+		"issues/HDDS-1": []byte("{\"id\":1,\"title\":\"<b>\"}"),
+		"issues/HDDS-2": []byte("{\n  \"a\": 1\n}\n"),
+		"issues/HDDS-3": []byte(" 42 "),
+		"issues/binary": {0, 1, 2},
+	}
+	for key, value := range values {
+		assert.Nil(t, from.Put(key, value))
+	}
+	assert.Nil(t, from.Put("pulls/1", []byte("{}")))
+
+	out := bytes.Buffer{}
+	counter, err := DumpJsonLines(from, &out, false, "issues/")
+	assert.Nil(t, err)
+	assert.Equal(t, 4, counter)
+
+	lines := strings.Split(strings.TrimSpace(out.String()), "\n")
+	sort.Strings(lines)
+	assert.Equal(t, []string{
+		`{"key":"issues/HDDS-1","value":{"id":1,"title":"<b>"}}`,
+		`{"key":"issues/HDDS-2","value":{"a":1}}`,
+		`{"key":"issues/HDDS-3","value":42}`,
+		`{"key":"issues/binary","value":"AAEC","encoding":"base64"}`,
+	}, lines)
+
+	//indented values are embedded as objects
+	record := map[string]interface{}{}
+	assert.Nil(t, json.Unmarshal([]byte(lines[1]), &record))
+	assert.Equal(t, map[string]interface{}{"a": float64(1)}, record["value"])
+
+	_ = os.Remove("/tmp/test")
+	to, err := CreateSqliteKV("/tmp/test")
+	assert.Nil(t, err)
+	defer to.Close()
+
+	counter, err = LoadJsonLines(&out, to)
+	assert.Nil(t, err)
+	assert.Equal(t, 4, counter)
+
+	//JSON values are restored in compact form
+	for key, expected := range map[string]string{
+		"issues/HDDS-1": "{\"id\":1,\"title\":\"<b>\"}",
+		"issues/HDDS-2": "{\"a\":1}",
+		"issues/HDDS-3": "42",
+		"issues/binary": "\x00\x01\x02",
+	} {
+		value, err := to.Get(key)
+		assert.Nil(t, err)
+		assert.Equal(t, expected, string(value), key)
+	}
+}
+
+func TestDumpLoadExactJsonLines(t *testing.T) {
+	_ = os.RemoveAll("/tmp/testx")
+	from := &DirKV{Path: "/tmp/testx"}
+	values := map[string][]byte{
+		"issues/HDDS-1": []byte("{\"id\":1,\"title\":\"<b>\"}"),
+		"issues/HDDS-2": []byte("{\n  \"a\": 1\n}\n"),
+		"issues/HDDS-3": []byte(" 42 "),
+		"issues/binary": {0, 1, 2},
+	}
+	for key, value := range values {
+		assert.Nil(t, from.Put(key, value))
+	}
+
+	out := bytes.Buffer{}
+	counter, err := DumpJsonLines(from, &out, true)
+	assert.Nil(t, err)
+	assert.Equal(t, 4, counter)
+
+	lines := strings.Split(strings.TrimSpace(out.String()), "\n")
+	sort.Strings(lines)
+	assert.Equal(t, []string{
+		`{"key":"issues/HDDS-1","value":{"id":1,"title":"<b>"}}`,
+		`{"key":"issues/HDDS-2","value":"ewogICJhIjogMQp9Cg==","encoding":"base64"}`,
+		`{"key":"issues/HDDS-3","value":"IDQyIA==","encoding":"base64"}`,
+		`{"key":"issues/binary","value":"AAEC","encoding":"base64"}`,
+	}, lines)
+
+	to := CreateMemoryKV()
+	counter, err = LoadJsonLines(&out, to)
+	assert.Nil(t, err)
+	assert.Equal(t, 4, counter)
+
+	//values are restored byte by byte
+	for key, expected := range values {
+		value, err := to.Get(key)
+		assert.Nil(t, err)
+		assert.Equal(t, expected, value, key)
+	}
+}
@@ -7,10 +7,15 @@ import "github.com/pkg/errors"
 
 type KV interface {
 	Put(key string, value []byte) error
+	// Delete removes the key from the store. Deleting a missing key is not an error.
+	Delete(key string) error
 	List(prefix string) ([]string, error)
+	// IterateAll calls the action for all the keys. The order is the same for an unchanged store (interrupted copies
+	// are resumed based on it).
 	IterateAll(action IteratorAction) error
 	Iterate(prefix string, action IteratorAction) error
 	IterateValues(prefix string, action KeyValueIteratorAction) error
+	// IterateSubTree calls the action for all the keys under the prefix, in the same order as IterateAll.
 	IterateSubTree(prefix string, action IteratorAction) error
 	Contains(key string) bool
 	GetOrDefault(key string, defaultFunc Getter) ([]byte, error)
@@ -20,6 +25,40 @@ type KV interface {
 	Close() error
 }
 
+// Reader is a read-only view of a KV store.
+type Reader interface {
+	List(prefix string) ([]string, error)
+	IterateAll(action IteratorAction) error
+	Iterate(prefix string, action IteratorAction) error
+	IterateValues(prefix string, action KeyValueIteratorAction) error
+	IterateSubTree(prefix string, action IteratorAction) error
+	Contains(key string) bool
+	Get(prefix string) ([]byte, error)
+	GetReader(prefix string) (io.Reader, error)
+	// Release frees the resources held by the view. The Reader shouldn't be used after Release.
+	Release() error
+}
+
+// Snapshotter is implemented by the stores which can provide a point-in-time view of their content.
+type Snapshotter interface {
+	// Snapshot returns a consistent, read-only view of the store. Writes after the Snapshot call are not visible.
+	Snapshot() (Reader, error)
+}
+
+// Batcher is implemented by the stores which can group the writes to batches.
+type Batcher interface {
+	// SetBatchSize sets the number of writes which are committed together (0 commits all the writes immediately).
+	SetBatchSize(size int)
+	// Commit writes out the pending batch.
+	Commit() error
+}
+
+// Counter is implemented by the stores which can count the keys without iterating over them.
+type Counter interface {
+	// Count returns the number of the keys under the prefix (including the keys of the sub-prefixes).
+	Count(prefix string) (int, error)
+}
+
 type Getter func(key string) ([]byte, error)
 
 type IteratorAction func(key string) error
@@ -36,7 +75,18 @@ func Copy(from KV, to KV) error {
 	})
 }
 
+// Snapshot returns a consistent read-only view of the store if the store supports it.
+func Snapshot(store KV) (Reader, error) {
+	if snapshotter, ok := store.(Snapshotter); ok {
+		return snapshotter.Snapshot()
+	}
+	return nil, errors.New("Store doesn't support snapshots")
+}
+
 func Create(path string) (KV, error) {
+	if strings.HasPrefix(path, "http://") || strings.HasPrefix(path, "https://") {
+		return CreateHttpKV(path), nil
+	}
 	parts := strings.Split(path, ":")
 	if len(parts) == 1 {
 		return &DirKV{
@@ -44,6 +94,10 @@ func Create(path string) (KV, error) {
 		}, nil
 	}  else if parts[0] == "sql" {
 		return CreateSqliteKV(parts[1])
+	} else if parts[0] == "pebble" {
+		return CreatePebble(parts[1])
+	} else if parts[0] == "mem" {
+		return CreateMemoryKV(), nil
 	} else {
 		return nil, errors.New("Unknown protocol " + parts[0])
 	}
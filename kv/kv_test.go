@@ -7,6 +7,9 @@ import (
 	"testing"
 )
 
+//pebble instance of the last getKvs call, closed by the next call as the tests don't close the stores
+var lastPebble *Pebble
+
 func getKvs() []KV {
 	kvs := make([]KV, 0)
 	_ = os.RemoveAll("/tmp/testx")
@@ -15,13 +18,17 @@ func getKvs() []KV {
 		Path: "/tmp/testx",
 	})
 
-	//
-	//_ = os.RemoveAll("/tmp/pebble")
-	//pebble, err := CreatePebble("/tmp/pebble")
-	//if err != nil {
-	//	panic(err)
-	//}
-	//kvs = append(kvs, pebble)
+	if lastPebble != nil {
+		//already closed by some of the tests
+		_ = lastPebble.Close()
+	}
+	_ = os.RemoveAll("/tmp/pebble")
+	pebble, err := CreatePebble("/tmp/pebble")
+	if err != nil {
+		panic(err)
+	}
+	lastPebble = pebble
+	kvs = append(kvs, pebble)
 
 	_ = os.Remove("./sqlite.db")
 	sqlite, err := CreateSqliteKV("./sqlite.db")
@@ -30,6 +37,8 @@ func getKvs() []KV {
 	}
 	kvs = append(kvs, sqlite)
 
+	kvs = append(kvs, CreateMemoryKV())
+
 	return kvs
 }
 func TestPutGet(t *testing.T) {
@@ -71,6 +80,33 @@ func TestList(t *testing.T) {
 	}
 }
 
+func TestListRoot(t *testing.T) {
+	for _, kv := range getKvs() {
+		list, err := kv.List("")
+		assert.Nil(t, err)
+		assert.Equal(t, 0, len(list))
+
+		for _, key := range []string{"key1", "dir1/key1", "dir1/dir2/key3", "dir10/key2"} {
+			assert.Nil(t, kv.Put(key, []byte("value1")))
+		}
+
+		list, err = kv.List("")
+		assert.Nil(t, err)
+		sort.Strings(list)
+		assert.Equal(t, []string{"dir1", "dir10", "key1"}, list)
+
+		//keys of dir10 are not under dir1
+		result := make([]string, 0)
+		err = kv.IterateSubTree("dir1", func(key string) error {
+			result = append(result, key)
+			return nil
+		})
+		assert.Nil(t, err)
+		sort.Strings(result)
+		assert.Equal(t, []string{"dir1/dir2/key3", "dir1/key1"}, result)
+	}
+}
+
 func TestIterator(t *testing.T) {
 	for _, kv := range getKvs() {
 		result := make([]string, 0)
@@ -100,6 +136,30 @@ func TestIterator(t *testing.T) {
 	}
 }
 
+func TestIterateAllOrder(t *testing.T) {
+	for _, kv := range getKvs() {
+		for _, key := range []string{"key1", "dir1/key2", "dir1/key1", "dir2/key1", "dir1/dir2/key3"} {
+			err := kv.Put(key, []byte("value1"))
+			assert.Nil(t, err)
+		}
+		iterate := func() []string {
+			result := make([]string, 0)
+			err := kv.IterateAll(func(key string) error {
+				result = append(result, key)
+				return nil
+			})
+			assert.Nil(t, err)
+			return result
+		}
+		first := iterate()
+
+		//rewritten keys keep their position
+		assert.Nil(t, kv.Delete("dir1/key1"))
+		assert.Nil(t, kv.Put("dir1/key1", []byte("value2")))
+		assert.Equal(t, first, iterate())
+	}
+}
+
 func TestContains(t *testing.T) {
 	for _, kv := range getKvs() {
 		err := kv.Put("key1", []byte("value1"))
@@ -140,4 +200,57 @@ func TestIterate(t *testing.T) {
 		sort.Strings(expected)
 		assert.Equal(t, expected, result)
 	}
-}
\ No newline at end of file
+}
+
+func TestIterateSubTree(t *testing.T) {
+	for _, kv := range getKvs() {
+		err := kv.Put("key1", []byte("value1"))
+		assert.Nil(t, err)
+
+		err = kv.Put("dir1/key1", []byte("value1"))
+		assert.Nil(t, err)
+
+		err = kv.Put("dir1/dir2/key3", []byte("value1"))
+		assert.Nil(t, err)
+
+		err = kv.Put("dir10/key1", []byte("value1"))
+		assert.Nil(t, err)
+
+		result := make([]string, 0)
+		err = kv.IterateSubTree("dir1", func(key string) error {
+			result = append(result, key)
+			return nil
+		})
+		assert.Nil(t, err)
+
+		expected := []string{"dir1/key1", "dir1/dir2/key3"}
+		sort.Strings(result)
+		sort.Strings(expected)
+		assert.Equal(t, expected, result)
+	}
+}
+
+func TestDelete(t *testing.T) {
+	for _, kv := range getKvs() {
+		err := kv.Put("dir1/key1", []byte("value1"))
+		assert.Nil(t, err)
+
+		assert.Nil(t, kv.Delete("dir1/key1"))
+		assert.False(t, kv.Contains("dir1/key1"))
+		assert.Nil(t, kv.Delete("dir1/key1"))
+	}
+}
+
+func TestDirModes(t *testing.T) {
+	_ = os.RemoveAll("/tmp/testx")
+	store := &DirKV{Path: "/tmp/testx", FileMode: 0600, DirMode: 0700}
+	assert.Nil(t, store.Put("dir1/key1", []byte("value1")))
+	for file, mode := range map[string]os.FileMode{
+		"/tmp/testx/dir1":      os.ModeDir | 0700,
+		"/tmp/testx/dir1/key1": 0600,
+	} {
+		stat, err := os.Stat(file)
+		assert.Nil(t, err)
+		assert.Equal(t, mode, stat.Mode(), file)
+	}
+}
@@ -0,0 +1,189 @@
+package kv
+
+import (
+	"bytes"
+	"github.com/pkg/errors"
+	"io"
+	"path"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+// MemoryKV is a KV store which keeps the values in memory. It's safe for concurrent use.
+type MemoryKV struct {
+	lock     sync.RWMutex
+	values   map[string][]byte
+	modified map[string]time.Time
+}
+
+func CreateMemoryKV() *MemoryKV {
+	return &MemoryKV{
+		values:   make(map[string][]byte),
+		modified: make(map[string]time.Time),
+	}
+}
+
+func (m *MemoryKV) Put(key string, value []byte) error {
+	m.lock.Lock()
+	defer m.lock.Unlock()
+	m.values[key] = append([]byte{}, value...)
+	m.modified[key] = time.Now()
+	return nil
+}
+
+func (m *MemoryKV) Delete(key string) error {
+	m.lock.Lock()
+	defer m.lock.Unlock()
+	delete(m.values, key)
+	delete(m.modified, key)
+	return nil
+}
+
+//keys returns the sorted keys which match the filter. The lock is not held during the iteration of the result,
+//therefore the actions can modify the store.
+func (m *MemoryKV) keys(filter func(key string) bool) []string {
+	m.lock.RLock()
+	defer m.lock.RUnlock()
+	result := make([]string, 0)
+	for key := range m.values {
+		if filter(key) {
+			result = append(result, key)
+		}
+	}
+	sort.Strings(result)
+	return result
+}
+
+func (m *MemoryKV) List(prefix string) ([]string, error) {
+	found := make(map[string]bool)
+	for _, key := range m.keys(func(key string) bool { return isUnder(prefix, key) }) {
+		child := strings.SplitN(strings.TrimPrefix(key, childPrefix(prefix)), "/", 2)[0]
+		found[path.Join(prefix, child)] = true
+	}
+	return sortedKeys(found), nil
+}
+
+func (m *MemoryKV) IterateAll(action IteratorAction) error {
+	return m.IterateSubTree("", action)
+}
+
+func (m *MemoryKV) Iterate(prefix string, action IteratorAction) error {
+	keys, _ := m.List(prefix)
+	for _, key := range keys {
+		err := action(key)
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (m *MemoryKV) IterateValues(prefix string, action KeyValueIteratorAction) error {
+	for _, key := range m.keys(func(key string) bool { return isUnder(prefix, key) && path.Dir(key) == rootPrefix(prefix) }) {
+		value, err := m.Get(key)
+		if err != nil {
+			//deleted by a previous action
+			continue
+		}
+		err = action(key, value)
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (m *MemoryKV) IterateSubTree(prefix string, action IteratorAction) error {
+	for _, key := range m.keys(func(key string) bool { return isUnder(prefix, key) }) {
+		err := action(key)
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (m *MemoryKV) Contains(key string) bool {
+	m.lock.RLock()
+	defer m.lock.RUnlock()
+	_, found := m.values[key]
+	return found
+}
+
+func (m *MemoryKV) GetOrDefault(key string, defaultFunc Getter) ([]byte, error) {
+	if !m.Contains(key) {
+		val, err := defaultFunc(key)
+		if err != nil {
+			return nil, err
+		}
+		err = m.Put(key, val)
+		if err != nil {
+			return nil, err
+		}
+		return val, nil
+	}
+	return m.Get(key)
+}
+
+func (m *MemoryKV) Get(key string) ([]byte, error) {
+	m.lock.RLock()
+	defer m.lock.RUnlock()
+	value, found := m.values[key]
+	if !found {
+		return nil, errors.New("No such key " + key)
+	}
+	return append([]byte{}, value...), nil
+}
+
+func (m *MemoryKV) GetReader(key string) (io.Reader, error) {
+	value, err := m.Get(key)
+	if err != nil {
+		return nil, err
+	}
+	return bytes.NewReader(value), nil
+}
+
+func (m *MemoryKV) IsChanged(since time.Time, key string) (bool, error) {
+	m.lock.RLock()
+	defer m.lock.RUnlock()
+	modified, found := m.modified[key]
+	if !found {
+		return true, nil
+	}
+	return modified.After(since), nil
+}
+
+func (m *MemoryKV) Close() error {
+	return nil
+}
+
+// Snapshot returns a copy of the current content.
+func (m *MemoryKV) Snapshot() (Reader, error) {
+	m.lock.RLock()
+	defer m.lock.RUnlock()
+	copied := CreateMemoryKV()
+	for key, value := range m.values {
+		copied.values[key] = value
+		copied.modified[key] = m.modified[key]
+	}
+	return &snapshot{
+		store: copied,
+		release: func() error {
+			return nil
+		},
+	}, nil
+}
+
+//childPrefix returns the string which starts all the keys under the prefix
+func childPrefix(prefix string) string {
+	if prefix == "" {
+		return ""
+	}
+	return strings.TrimSuffix(prefix, "/") + "/"
+}
+
+func isUnder(prefix string, key string) bool {
+	return strings.HasPrefix(key, childPrefix(prefix))
+}
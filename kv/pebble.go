@@ -9,8 +9,8 @@ import (
 )
 
 type Pebble struct {
-	db *pebble.DB
-
+	db       *pebble.DB
+	snapshot *pebble.Snapshot
 }
 
 func CreatePebble(dir string) (*Pebble, error) {
@@ -25,54 +25,64 @@ func CreatePebble(dir string) (*Pebble, error) {
 	}, nil
 }
 
+// reader returns the snapshot for snapshot instances, otherwise the database itself.
+func (pb *Pebble) reader() pebble.Reader {
+	if pb.snapshot != nil {
+		return pb.snapshot
+	}
+	return pb.db
+}
+
 func (pb *Pebble) Put(key string, value []byte) error {
 	return pb.db.Set([]byte(key), value, &pebble.WriteOptions{
 		Sync: false,
 	})
 }
 
+func (pb *Pebble) Delete(key string) error {
+	return pb.db.Delete([]byte(key), &pebble.WriteOptions{
+		Sync: false,
+	})
+}
+
 func (pb *Pebble) List(prefix string) ([]string, error) {
 	result := make([]string, 0)
-	it := pb.db.NewIter(nil)
-	it.SeekGE([]byte(prefix))
-	for {
-		key := string(it.Key())
-		if !strings.HasPrefix(key, prefix) {
-			break
-		}
-		rel := key[len(prefix)+1:]
-		parts := strings.Split(rel, "/")
-		if len(parts) > 1 {
-			subdir := prefix + "/" + parts[0]
-			result = append(result, subdir)
-			for {
-				it.Next()
-				nextKey := string(it.Key())
-				if !strings.HasPrefix(nextKey, subdir) {
-					break
-				}
-			}
-		} else {
-			result = append(result, key)
-			if !it.Next() {
-				break
-			}
-		}
+	err := pb.Iterate(prefix, func(key string) error {
+		result = append(result, key)
+		return nil
+	})
+	return result, err
+}
 
+//subTreeOptions limits the iteration to the keys under the prefix
+func subTreeOptions(prefix string) *pebble.IterOptions {
+	lower := childPrefix(prefix)
+	if lower == "" {
+		return &pebble.IterOptions{}
+	}
+	//'0' is the next character after '/'
+	return &pebble.IterOptions{
+		LowerBound: []byte(lower),
+		UpperBound: []byte(strings.TrimSuffix(lower, "/") + "0"),
 	}
-	return result, nil
 }
 
 func (pb *Pebble) Contains(key string) bool {
-	return false
+	_, closer, err := pb.reader().Get([]byte(key))
+	if err != nil {
+		return false
+	}
+	_ = closer.Close()
+	return true
 }
 
 func (pb *Pebble) Get(prefix string) ([]byte, error) {
-	data, _, err := pb.db.Get([]byte(prefix))
+	data, closer, err := pb.reader().Get([]byte(prefix))
 	if err != nil {
 		return nil, err
 	}
-	return data, nil
+	defer closer.Close()
+	return append([]byte{}, data...), nil
 }
 
 func (pb *Pebble) GetReader(prefix string) (io.Reader, error) {
@@ -94,78 +104,82 @@ func (pb *Pebble) GetOrDefault(key string, defaultFunc Getter) ([]byte, error) {
 	return pb.Get(key)
 }
 
+//Iterate calls the action for the keys and the subdirectories directly under the prefix.
 func (pb *Pebble) Iterate(prefix string, action IteratorAction) error {
-	it := pb.db.NewIter(nil)
-	it.SeekGE([]byte(prefix))
-	for {
+	base := childPrefix(prefix)
+	it := pb.reader().NewIter(subTreeOptions(prefix))
+	defer it.Close()
+	for valid := it.First(); valid; {
 		key := string(it.Key())
-		if !strings.HasPrefix(key, prefix) {
-			break
-		}
-		rel := key[len(prefix)+1:]
-		parts := strings.Split(rel, "/")
-		if len(parts) > 1 {
-			subdir := prefix + "/" + parts[0]
+		rel := key[len(base):]
+		if slash := strings.Index(rel, "/"); slash >= 0 {
+			subdir := base + rel[:slash]
 			err := action(subdir)
 			if err != nil {
 				return err
 			}
-			for {
-				it.Next()
-				nextKey := string(it.Key())
-				if !strings.HasPrefix(nextKey, subdir) {
-					break
-				}
-			}
+			//skip the remaining keys of the subdirectory
+			valid = it.SeekGE([]byte(subdir + "0"))
 		} else {
 			err := action(key)
 			if err != nil {
 				return err
 			}
-			if !it.Next() {
-				break
-			}
+			valid = it.Next()
 		}
-
 	}
 	return nil
 }
 
 func (pb *Pebble) IterateAll(action IteratorAction) error {
-	it := pb.db.NewIter(nil)
-	it.First()
-	for {
-		key := string(it.Key())
-		err := action(key)
+	return pb.IterateSubTree("", action)
+}
+
+func (pb *Pebble) IsChanged(since time.Time, prefix string) (bool, error) {
+	return true, nil
+}
+
+func (pb *Pebble) IterateSubTree(prefix string, action IteratorAction) error {
+	it := pb.reader().NewIter(subTreeOptions(prefix))
+	defer it.Close()
+	for valid := it.First(); valid; valid = it.Next() {
+		err := action(string(it.Key()))
 		if err != nil {
 			return err
 		}
-		if !it.Next() {
-			break
-		}
 	}
 	return nil
 }
-func (pb *Pebble) IsChanged(since time.Time, prefix string) (bool, error) {
-	return true, nil
-}
-func (pb *Pebble) IterateSubTree(prefix string, action IteratorAction) error {
-	options := pebble.IterOptions{LowerBound: []byte(prefix)}
-	it := pb.db.NewIter(&options)
-	it.First()
-	for {
+
+func (pb *Pebble) IterateValues(prefix string, action KeyValueIteratorAction) error {
+	base := childPrefix(prefix)
+	it := pb.reader().NewIter(subTreeOptions(prefix))
+	defer it.Close()
+	for valid := it.First(); valid; valid = it.Next() {
 		key := string(it.Key())
-		err := action(key)
+		if strings.Contains(key[len(base):], "/") {
+			continue
+		}
+		err := action(key, append([]byte{}, it.Value()...))
 		if err != nil {
 			return err
 		}
-		if !it.Next() {
-			break
-		}
 	}
 	return nil
 }
 
 func (pb *Pebble) Close() error {
-	return nil
-}
\ No newline at end of file
+	return pb.db.Close()
+}
+
+// Snapshot returns a read-only view backed by a pebble snapshot.
+func (pb *Pebble) Snapshot() (Reader, error) {
+	view := pb.db.NewSnapshot()
+	return &snapshot{
+		store: &Pebble{
+			db:       pb.db,
+			snapshot: view,
+		},
+		release: view.Close,
+	}, nil
+}
@@ -0,0 +1,46 @@
+package kv
+
+import "io"
+
+//snapshot exposes only the read methods of a store instance which is bound to a point-in-time view, therefore the
+//writes (and Close) of the underlying store can't be reached with a type assertion.
+type snapshot struct {
+	store   KV
+	release func() error
+}
+
+func (s *snapshot) List(prefix string) ([]string, error) {
+	return s.store.List(prefix)
+}
+
+func (s *snapshot) IterateAll(action IteratorAction) error {
+	return s.store.IterateAll(action)
+}
+
+func (s *snapshot) Iterate(prefix string, action IteratorAction) error {
+	return s.store.Iterate(prefix, action)
+}
+
+func (s *snapshot) IterateValues(prefix string, action KeyValueIteratorAction) error {
+	return s.store.IterateValues(prefix, action)
+}
+
+func (s *snapshot) IterateSubTree(prefix string, action IteratorAction) error {
+	return s.store.IterateSubTree(prefix, action)
+}
+
+func (s *snapshot) Contains(key string) bool {
+	return s.store.Contains(key)
+}
+
+func (s *snapshot) Get(key string) ([]byte, error) {
+	return s.store.Get(key)
+}
+
+func (s *snapshot) GetReader(key string) (io.Reader, error) {
+	return s.store.GetReader(key)
+}
+
+func (s *snapshot) Release() error {
+	return s.release()
+}
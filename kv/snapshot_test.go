@@ -0,0 +1,94 @@
+package kv
+
+import (
+	"github.com/stretchr/testify/assert"
+	"io"
+	"os"
+	"sort"
+	"testing"
+)
+
+func TestSnapshot(t *testing.T) {
+	for _, store := range getKvs() {
+		err := store.Put("dir1/key1", []byte("value1"))
+		assert.Nil(t, err)
+
+		snapshot, err := Snapshot(store)
+		assert.Nil(t, err)
+
+		//the writes of the underlying store are not exposed
+		_, writable := snapshot.(KV)
+		assert.False(t, writable)
+		_, closable := snapshot.(io.Closer)
+		assert.False(t, closable)
+
+		err = store.Put("dir1/key1", []byte("value2"))
+		assert.Nil(t, err)
+
+		err = store.Put("dir1/key2", []byte("value2"))
+		assert.Nil(t, err)
+
+		value, err := snapshot.Get("dir1/key1")
+		assert.Nil(t, err)
+		assert.Equal(t, []byte("value1"), value)
+		assert.False(t, snapshot.Contains("dir1/key2"))
+
+		keys := make([]string, 0)
+		err = snapshot.IterateValues("dir1", func(key string, value []byte) error {
+			keys = append(keys, key+"="+string(value))
+			return nil
+		})
+		assert.Nil(t, err)
+		assert.Equal(t, []string{"dir1/key1=value1"}, keys)
+
+		assert.Nil(t, snapshot.Release())
+
+		value, err = store.Get("dir1/key1")
+		assert.Nil(t, err)
+		assert.Equal(t, []byte("value2"), value)
+		assert.Nil(t, store.Close())
+	}
+}
+
+func TestDirSnapshotIgnoresTempFiles(t *testing.T) {
+	_ = os.RemoveAll("/tmp/testx")
+	store := &DirKV{Path: "/tmp/testx"}
+	assert.Nil(t, store.Put("dir1/key1", []byte("value1")))
+	assert.Nil(t, store.Put("dir1/key2", []byte("value1")))
+
+	snapshot, err := store.Snapshot()
+	assert.Nil(t, err)
+	defer snapshot.Release()
+
+	keys := make([]string, 0)
+	err = snapshot.IterateAll(func(key string) error {
+		keys = append(keys, key)
+		return nil
+	})
+	assert.Nil(t, err)
+	sort.Strings(keys)
+	assert.Equal(t, []string{"dir1/key1", "dir1/key2"}, keys)
+}
+
+func TestDirSnapshotRelativePath(t *testing.T) {
+	_ = os.RemoveAll("/tmp/testrel")
+	assert.Nil(t, os.MkdirAll("/tmp/testrel/store", 0755))
+	cwd, err := os.Getwd()
+	assert.Nil(t, err)
+	assert.Nil(t, os.Chdir("/tmp/testrel/store"))
+	defer os.Chdir(cwd)
+
+	store := &DirKV{Path: "."}
+	assert.Nil(t, store.Put("key1", []byte("value1")))
+	snapshot, err := store.Snapshot()
+	assert.Nil(t, err)
+	defer snapshot.Release()
+
+	//the snapshot is not created inside the store
+	keys, err := store.List("")
+	assert.Nil(t, err)
+	assert.Equal(t, []string{"key1"}, keys)
+	value, err := snapshot.Get("key1")
+	assert.Nil(t, err)
+	assert.Equal(t, []byte("value1"), value)
+}
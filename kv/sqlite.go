@@ -1,6 +1,7 @@
 package kv
 
 import (
+	"bytes"
 	"database/sql"
 	_ "github.com/mattn/go-sqlite3"
 	"github.com/pkg/errors"
@@ -8,6 +9,7 @@ import (
 	"path"
 	"strconv"
 	"strings"
+	"sync"
 	"time"
 )
 
@@ -17,12 +19,15 @@ type SqliteKV struct {
 	transactionSize        int
 	currentTransactionSize int
 	tx                     *sql.Tx
+	snapshot               *sql.Tx
+	//guards the write transaction and the prefix cache
+	lock sync.Mutex
 }
 
 func CreateSqliteKV(uri string) (*SqliteKV, error) {
 	uriparts := strings.Split(uri, "?")
 
-	db, err := sql.Open("sqlite3", uriparts[0]+"?_sync=0")
+	db, err := sql.Open("sqlite3", uriparts[0]+"?_sync=0&_journal_mode=WAL")
 	if err != nil {
 		return nil, err
 	}
@@ -30,6 +35,7 @@ func CreateSqliteKV(uri string) (*SqliteKV, error) {
 	sqlStmt := `
 	create table if not exists prefix (prefix integer not null, key text, PRIMARY KEY (prefix, key));
 	create table if not exists key (prefix integer not null, key text, value text, PRIMARY KEY (prefix, key));
+	create view if not exists kv as select case when prefix = '.' then key else prefix || '/' || key end as key, prefix, key as name, cast(value as text) as value from key;
 	`
 	_, err = db.Exec(sqlStmt)
 	if err != nil {
@@ -54,10 +60,16 @@ func CreateSqliteKV(uri string) (*SqliteKV, error) {
 }
 
 func (s *SqliteKV) ExecQuery(query string, args ...interface{}) error {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	return s.execQuery(query, args...)
+}
+
+func (s *SqliteKV) execQuery(query string, args ...interface{}) error {
 	var err error
 	if s.transactionSize > 0 {
 		if s.tx == nil {
-			s.transactionSize = 0
+			s.currentTransactionSize = 0
 			tx, err := s.db.Begin()
 			s.tx = tx
 			if err != nil {
@@ -72,6 +84,8 @@ func (s *SqliteKV) ExecQuery(query string, args ...interface{}) error {
 		if s.currentTransactionSize >= s.transactionSize {
 			err = s.tx.Commit()
 			if err != nil {
+				//prefixes of the failed transaction are not stored
+				s.prefixCache = make(map[string]bool)
 				return err
 			}
 			s.tx = nil
@@ -86,9 +100,12 @@ func (s *SqliteKV) ExecQuery(query string, args ...interface{}) error {
 }
 
 func (s *SqliteKV) Commit() error {
+	s.lock.Lock()
+	defer s.lock.Unlock()
 	if s.tx != nil {
 		err := s.tx.Commit()
 		if err != nil {
+			s.prefixCache = make(map[string]bool)
 			return err
 		}
 		s.tx = nil
@@ -98,26 +115,95 @@ func (s *SqliteKV) Commit() error {
 
 }
 
+// SetBatchSize sets the number of the writes in one transaction. The pending transaction is committed.
+func (s *SqliteKV) SetBatchSize(size int) {
+	_ = s.Commit()
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	s.transactionSize = size
+}
+
+func (s *SqliteKV) Count(prefix string) (int, error) {
+	var res *sql.Rows
+	var err error
+	if prefix == "" {
+		res, err = s.query("SELECT count(*) FROM key")
+	} else {
+		res, err = s.query("SELECT count(*) FROM key WHERE prefix = ? OR prefix LIKE ? ESCAPE '\\'", prefix, escapeLike(prefix)+"/%")
+	}
+	if err != nil {
+		return 0, err
+	}
+	defer res.Close()
+	count := 0
+	if res.Next() {
+		err = res.Scan(&count)
+	}
+	if err == nil {
+		err = res.Err()
+	}
+	return count, err
+}
+
+// query executes read queries in the snapshot transaction if the instance is a snapshot.
+func (s *SqliteKV) query(query string, args ...interface{}) (*sql.Rows, error) {
+	if s.snapshot != nil {
+		return s.snapshot.Query(query, args...)
+	}
+	return s.db.Query(query, args...)
+}
+
+// rootPrefix returns the prefix used in the tables for the keys without parent directory.
+func rootPrefix(prefix string) string {
+	if prefix == "" {
+		return "."
+	}
+	return prefix
+}
+
 func (s *SqliteKV) Put(key string, value []byte) error {
+	s.lock.Lock()
+	defer s.lock.Unlock()
 	if _, found := s.prefixCache[path.Dir(key)]; !found {
 		for parent := path.Dir(key); parent != "."; parent = path.Dir(parent) {
-			err := s.ExecQuery("INSERT INTO prefix (prefix,key) VALUES (?,?) ON CONFLICT DO NOTHING", path.Dir(parent), path.Base(parent))
+			err := s.execQuery("INSERT INTO prefix (prefix,key) VALUES (?,?) ON CONFLICT DO NOTHING", path.Dir(parent), path.Base(parent))
 			if err != nil {
 				return err
 			}
 		}
 		s.prefixCache[path.Dir(key)] = true
 	}
-	err := s.ExecQuery("INSERT INTO key (prefix,key,value) VALUES (?,?,?)", path.Dir(key), path.Base(key), value)
+	err := s.execQuery("INSERT OR REPLACE INTO key (prefix,key,value) VALUES (?,?,?)", path.Dir(key), path.Base(key), value)
 	if err != nil {
 		return err
 	}
 	return err
 }
 
+// Delete removes the key. Prefixes which become empty are also removed from the prefix table (like the empty
+// directories of DirKV).
+func (s *SqliteKV) Delete(key string) error {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	err := s.execQuery("DELETE FROM key WHERE prefix = ? AND key = ?", path.Dir(key), path.Base(key))
+	if err != nil {
+		return err
+	}
+	for parent := path.Dir(key); parent != "."; parent = path.Dir(parent) {
+		err = s.execQuery("DELETE FROM prefix WHERE prefix = ? AND key = ? "+
+			"AND NOT EXISTS (SELECT 1 FROM key WHERE prefix = ?) AND NOT EXISTS (SELECT 1 FROM prefix WHERE prefix = ?)",
+			path.Dir(parent), path.Base(parent), parent, parent)
+		if err != nil {
+			return err
+		}
+		delete(s.prefixCache, parent)
+	}
+	return nil
+}
+
 func (s *SqliteKV) List(prefix string) ([]string, error) {
 	result := make([]string, 0)
-	res, err := s.db.Query("SELECT key FROM key WHERE prefix = ?", prefix)
+	res, err := s.query("SELECT key FROM key WHERE prefix = ?", rootPrefix(prefix))
 	if err != nil {
 		return result, err
 	}
@@ -130,7 +216,7 @@ func (s *SqliteKV) List(prefix string) ([]string, error) {
 		result = append(result, path.Join(prefix, key))
 	}
 	res.Close()
-	res, err = s.db.Query("SELECT key FROM prefix WHERE prefix = ?", prefix)
+	res, err = s.query("SELECT key FROM prefix WHERE prefix = ?", rootPrefix(prefix))
 	if err != nil {
 		return result, err
 	}
@@ -146,14 +232,14 @@ func (s *SqliteKV) List(prefix string) ([]string, error) {
 }
 
 func (s *SqliteKV) IterateAll(action IteratorAction) error {
-	res, err := s.db.Query("SELECT * FROM key")
+	res, err := s.query("SELECT prefix, key FROM key ORDER BY prefix, key")
 	defer res.Close()
 	if err != nil {
 		return err
 	}
-	var prefix, key, value string
+	var prefix, key string
 	for ; res.Next(); {
-		err = res.Scan(&prefix, &key, &value)
+		err = res.Scan(&prefix, &key)
 		if err != nil {
 			return err
 		}
@@ -166,7 +252,7 @@ func (s *SqliteKV) IterateAll(action IteratorAction) error {
 }
 
 func (s *SqliteKV) Iterate(prefix string, action IteratorAction) error {
-	res, err := s.db.Query("SELECT key FROM key WHERE prefix = ?", path.Base(prefix))
+	res, err := s.query("SELECT key FROM key WHERE prefix = ?", rootPrefix(prefix))
 	if err != nil {
 		return err
 	}
@@ -182,7 +268,7 @@ func (s *SqliteKV) Iterate(prefix string, action IteratorAction) error {
 		}
 	}
 	res.Close()
-	res, err = s.db.Query("SELECT key FROM prefix WHERE prefix = ?", prefix)
+	res, err = s.query("SELECT key FROM prefix WHERE prefix = ?", rootPrefix(prefix))
 	if err != nil {
 		return err
 	}
@@ -202,7 +288,7 @@ func (s *SqliteKV) Iterate(prefix string, action IteratorAction) error {
 
 func (s *SqliteKV) IterateValues(prefix string, action KeyValueIteratorAction) error {
 	var key, value string
-	res, err := s.db.Query("SELECT key,value FROM key WHERE prefix = ?", prefix)
+	res, err := s.query("SELECT key,value FROM key WHERE prefix = ?", rootPrefix(prefix))
 	defer res.Close()
 	if err != nil {
 		return err
@@ -221,11 +307,30 @@ func (s *SqliteKV) IterateValues(prefix string, action KeyValueIteratorAction) e
 }
 
 func (s *SqliteKV) IterateSubTree(prefix string, action IteratorAction) error {
-	panic("implement me")
+	if prefix == "" {
+		return s.IterateAll(action)
+	}
+	res, err := s.query("SELECT prefix, key FROM key WHERE prefix = ? OR prefix LIKE ? ESCAPE '\\' ORDER BY prefix, key", prefix, escapeLike(prefix)+"/%")
+	if err != nil {
+		return err
+	}
+	defer res.Close()
+	var keyPrefix, key string
+	for res.Next() {
+		err = res.Scan(&keyPrefix, &key)
+		if err != nil {
+			return err
+		}
+		err = action(path.Join(keyPrefix, key))
+		if err != nil {
+			return err
+		}
+	}
+	return res.Err()
 }
 
 func (s *SqliteKV) Contains(key string) bool {
-	res, err := s.db.Query("SELECT * FROM key WHERE prefix = ? AND key = ?", path.Dir(key), path.Base(key))
+	res, err := s.query("SELECT * FROM key WHERE prefix = ? AND key = ?", path.Dir(key), path.Base(key))
 	defer res.Close()
 	if err != nil {
 		return false
@@ -234,7 +339,7 @@ func (s *SqliteKV) Contains(key string) bool {
 }
 
 func (s *SqliteKV) GetOrDefault(key string, defaultFunc Getter) ([]byte, error) {
-	res, err := s.db.Query("SELECT value FROM key WHERE prefix = ? AND key = ?", path.Dir(key), path.Base(key))
+	res, err := s.query("SELECT value FROM key WHERE prefix = ? AND key = ?", path.Dir(key), path.Base(key))
 	defer res.Close()
 	if err != nil {
 		return []byte{}, err
@@ -252,7 +357,7 @@ func (s *SqliteKV) GetOrDefault(key string, defaultFunc Getter) ([]byte, error)
 }
 
 func (s *SqliteKV) Get(key string) ([]byte, error) {
-	res, err := s.db.Query("SELECT value FROM key WHERE prefix = ? AND key = ?", path.Dir(key), path.Base(key))
+	res, err := s.query("SELECT value FROM key WHERE prefix = ? AND key = ?", path.Dir(key), path.Base(key))
 	defer res.Close()
 	if err != nil {
 		return []byte{}, err
@@ -270,19 +375,125 @@ func (s *SqliteKV) Get(key string) ([]byte, error) {
 }
 
 func (s *SqliteKV) GetReader(prefix string) (io.Reader, error) {
-	panic("implement me")
+	value, err := s.Get(prefix)
+	if err != nil {
+		return nil, err
+	}
+	return bytes.NewReader(value), nil
 }
 
+// IsChanged always returns true as modification times are not stored.
 func (s *SqliteKV) IsChanged(since time.Time, prefix string) (bool, error) {
-	panic("implement me")
+	return true, nil
 }
 
 func (sql *SqliteKV) Close() error {
+	sql.lock.Lock()
+	defer sql.lock.Unlock()
 	if sql.tx != nil {
 		err := sql.tx.Commit()
 		if err != nil {
 			return err
 		}
+		sql.tx = nil
 	}
-	return nil
+	return sql.db.Close()
+}
+
+// Snapshot returns a read-only view of the store backed by a read transaction.
+func (s *SqliteKV) Snapshot() (Reader, error) {
+	tx, err := s.db.Begin()
+	if err != nil {
+		return nil, err
+	}
+	//read transaction is started by the first read
+	var exists bool
+	err = tx.QueryRow("SELECT EXISTS(SELECT 1 FROM key)").Scan(&exists)
+	if err != nil {
+		_ = tx.Rollback()
+		return nil, err
+	}
+	return &snapshot{
+		store: &SqliteKV{
+			db:          s.db,
+			prefixCache: make(map[string]bool),
+			snapshot:    tx,
+		},
+		release: tx.Rollback,
+	}, nil
+}
+
+// Check verifies the consistency of the prefix table: all the parent prefixes of the keys should be stored, and all the
+// stored prefixes should have at least one key under them. With repair the missing prefixes are added and the stale
+// ones are removed.
+func (s *SqliteKV) Check(repair bool) ([]Problem, error) {
+	problems := make([]Problem, 0)
+	required := make(map[string]bool)
+	res, err := s.query("SELECT DISTINCT prefix FROM key")
+	if err != nil {
+		return problems, err
+	}
+	var prefix, key string
+	for res.Next() {
+		err = res.Scan(&prefix)
+		if err != nil {
+			res.Close()
+			return problems, err
+		}
+		for parent := prefix; parent != "."; parent = path.Dir(parent) {
+			required[parent] = true
+		}
+	}
+	res.Close()
+
+	existing := make(map[string]bool)
+	res, err = s.query("SELECT prefix, key FROM prefix")
+	if err != nil {
+		return problems, err
+	}
+	for res.Next() {
+		err = res.Scan(&prefix, &key)
+		if err != nil {
+			res.Close()
+			return problems, err
+		}
+		existing[path.Join(prefix, key)] = true
+	}
+	res.Close()
+
+	for _, p := range sortedKeys(required) {
+		if existing[p] {
+			continue
+		}
+		problem := Problem{Key: p, Description: "prefix of stored keys is missing from the prefix table"}
+		if repair {
+			err = s.ExecQuery("INSERT INTO prefix (prefix,key) VALUES (?,?) ON CONFLICT DO NOTHING", path.Dir(p), path.Base(p))
+			if err != nil {
+				return problems, err
+			}
+			problem.Repaired = true
+		}
+		problems = append(problems, problem)
+	}
+	for _, p := range sortedKeys(existing) {
+		if required[p] {
+			continue
+		}
+		problem := Problem{Key: p, Description: "prefix doesn't have any key"}
+		if repair {
+			err = s.ExecQuery("DELETE FROM prefix WHERE prefix = ? AND key = ?", path.Dir(p), path.Base(p))
+			if err != nil {
+				return problems, err
+			}
+			problem.Repaired = true
+		}
+		problems = append(problems, problem)
+	}
+	if repair {
+		s.lock.Lock()
+		s.prefixCache = make(map[string]bool)
+		s.lock.Unlock()
+		return problems, s.Commit()
+	}
+	return problems, nil
 }
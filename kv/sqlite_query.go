@@ -0,0 +1,88 @@
+package kv
+
+import (
+	"github.com/pkg/errors"
+	"strings"
+)
+
+// RowAction is called for each row of a query result with the column names and the values of the row.
+type RowAction func(columns []string, values []interface{}) error
+
+// Query executes an SQL statement and calls action for each returned row.
+//
+// Besides the raw tables the statement can use the `kv` view which has one row per stored key with the columns
+// `key` (full key), `prefix`, `name` (last element of the key) and `value` (value as text). As values are usually JSON
+// documents, the SQLite JSON1 functions can be used to filter and project them:
+//
+//	SELECT key, json_extract(value, '$.fields.status.name') FROM kv WHERE key LIKE 'issues/%'
+//
+// The statement is executed as is, it's intended to be used with SELECT queries.
+func (s *SqliteKV) Query(query string, action RowAction, args ...interface{}) error {
+	res, err := s.query(query, args...)
+	if err != nil {
+		return err
+	}
+	defer res.Close()
+	columns, err := res.Columns()
+	if err != nil {
+		return err
+	}
+	if len(columns) == 0 {
+		return errors.New("Query doesn't return any column: " + query)
+	}
+	for res.Next() {
+		values := make([]interface{}, len(columns))
+		pointers := make([]interface{}, len(columns))
+		for i := range values {
+			pointers[i] = &values[i]
+		}
+		err = res.Scan(pointers...)
+		if err != nil {
+			return err
+		}
+		for i, value := range values {
+			if raw, ok := value.([]byte); ok {
+				values[i] = string(raw)
+			}
+		}
+		err = action(columns, values)
+		if err != nil {
+			return err
+		}
+	}
+	return res.Err()
+}
+
+// Select projects the values stored under the prefix (including all the sub-prefixes) with JSON paths.
+//
+// Paths are dot separated field names (like `fields.status.name`) or JSON1 paths starting with `$`. The first column
+// of each row is the key, followed by one column for each path.
+func (s *SqliteKV) Select(prefix string, paths []string, action RowAction) error {
+	prefix = strings.TrimSuffix(strings.TrimSuffix(prefix, "*"), "/")
+	query := "SELECT key"
+	args := make([]interface{}, 0)
+	for _, p := range paths {
+		query += ", json_extract(value, ?) AS \"" + strings.ReplaceAll(p, "\"", "\"\"") + "\""
+		args = append(args, jsonPath(p))
+	}
+	query += " FROM kv"
+	if prefix != "" {
+		query += " WHERE key LIKE ? ESCAPE '\\'"
+		args = append(args, escapeLike(prefix)+"/%")
+	}
+	query += " ORDER BY key"
+	return s.Query(query, action, args...)
+}
+
+func jsonPath(p string) string {
+	if strings.HasPrefix(p, "$") {
+		return p
+	}
+	return "$." + p
+}
+
+func escapeLike(value string) string {
+	value = strings.ReplaceAll(value, "\\", "\\\\")
+	value = strings.ReplaceAll(value, "%", "\\%")
+	return strings.ReplaceAll(value, "_", "\\_")
+}
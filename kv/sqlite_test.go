@@ -78,3 +78,68 @@ func TestPrefixTable(t *testing.T) {
 
 
 }
+
+func TestSelect(t *testing.T) {
+	os.Remove("/tmp/test")
+	kv, err := CreateSqliteKV("/tmp/test")
+	assert.Nil(t, err)
+	defer kv.Close()
+
+	err = kv.Put("issues/HDDS-1", []byte(`{"fields":{"status":{"name":"Open"}}}`))
+	assert.Nil(t, err)
+	err = kv.Put("issues/HDDS-2", []byte(`{"fields":{"status":{"name":"Resolved"}}}`))
+	assert.Nil(t, err)
+	err = kv.Put("pulls/1", []byte(`{"fields":{"status":{"name":"Closed"}}}`))
+	assert.Nil(t, err)
+
+	result := make([]string, 0)
+	err = kv.Select("issues/*", []string{"fields.status.name"}, func(columns []string, values []interface{}) error {
+		assert.Equal(t, []string{"key", "fields.status.name"}, columns)
+		result = append(result, values[0].(string)+"="+values[1].(string))
+		return nil
+	})
+	assert.Nil(t, err)
+	assert.Equal(t, []string{"issues/HDDS-1=Open", "issues/HDDS-2=Resolved"}, result)
+}
+
+func TestQuery(t *testing.T) {
+	os.Remove("/tmp/test")
+	kv, err := CreateSqliteKV("/tmp/test")
+	assert.Nil(t, err)
+	defer kv.Close()
+
+	err = kv.Put("issues/HDDS-1", []byte(`{"fields":{"status":{"name":"Open"}}}`))
+	assert.Nil(t, err)
+	err = kv.Put("issues/HDDS-2", []byte(`{"fields":{"status":{"name":"Resolved"}}}`))
+	assert.Nil(t, err)
+
+	result := make([]interface{}, 0)
+	err = kv.Query("SELECT key FROM kv WHERE json_extract(value, '$.fields.status.name') = ?", func(columns []string, values []interface{}) error {
+		result = append(result, values[0])
+		return nil
+	}, "Resolved")
+	assert.Nil(t, err)
+	assert.Equal(t, []interface{}{"issues/HDDS-2"}, result)
+}
+
+func TestCount(t *testing.T) {
+	os.Remove("/tmp/test")
+	kv, err := CreateSqliteKV("/tmp/test")
+	assert.Nil(t, err)
+	defer kv.Close()
+	kv.SetBatchSize(2)
+	for _, key := range []string{"a/1", "a/2", "a/b/3", "ab/4", "c"} {
+		err = kv.Put(key, []byte("asd"))
+		assert.Nil(t, err)
+	}
+	err = kv.Commit()
+	assert.Nil(t, err)
+
+	count, err := kv.Count("")
+	assert.Nil(t, err)
+	assert.Equal(t, 5, count)
+
+	count, err = kv.Count("a")
+	assert.Nil(t, err)
+	assert.Equal(t, 3, count)
+}
@@ -0,0 +1,130 @@
+package kv
+
+import (
+	"bytes"
+	"github.com/pkg/errors"
+	"strings"
+	"time"
+)
+
+// SyncAction is the type of the change applied to a key during Sync.
+type SyncAction string
+
+const (
+	Added   SyncAction = "added"
+	Updated SyncAction = "updated"
+	Deleted SyncAction = "deleted"
+)
+
+type SyncOptions struct {
+	// Prefix limits the sync to the keys starting with the prefix.
+	Prefix string
+	// Delete removes the keys from the destination which are missing from the source.
+	Delete bool
+	// DryRun only reports the changes without modifying the destination.
+	DryRun bool
+	// Since skips the value comparison of existing keys if the source reports no change (see KV.IsChanged) since
+	// this time.
+	Since time.Time
+	// OnChange is called for each added, updated or deleted key (if defined).
+	OnChange func(action SyncAction, key string)
+}
+
+type SyncResult struct {
+	Added     int
+	Updated   int
+	Deleted   int
+	Unchanged int
+}
+
+// Sync copies the new and changed keys from one store to the other.
+func Sync(from KV, to KV, options SyncOptions) (SyncResult, error) {
+	result := SyncResult{}
+	sourceKeys := make(map[string]bool)
+	err := from.IterateAll(func(key string) error {
+		if !strings.HasPrefix(key, options.Prefix) {
+			return nil
+		}
+		if options.Delete {
+			sourceKeys[key] = true
+		}
+		action, err := syncKey(from, to, key, options)
+		if err != nil {
+			return errors.Wrap(err, "Couldn't sync key "+key)
+		}
+		switch action {
+		case Added:
+			result.Added++
+		case Updated:
+			result.Updated++
+		default:
+			result.Unchanged++
+			return nil
+		}
+		if options.OnChange != nil {
+			options.OnChange(action, key)
+		}
+		return nil
+	})
+	if err != nil || !options.Delete {
+		return result, err
+	}
+
+	extraneous := make([]string, 0)
+	err = to.IterateAll(func(key string) error {
+		if strings.HasPrefix(key, options.Prefix) && !sourceKeys[key] {
+			extraneous = append(extraneous, key)
+		}
+		return nil
+	})
+	if err != nil {
+		return result, err
+	}
+	for _, key := range extraneous {
+		if !options.DryRun {
+			err = to.Delete(key)
+			if err != nil {
+				return result, errors.Wrap(err, "Couldn't delete key "+key)
+			}
+		}
+		result.Deleted++
+		if options.OnChange != nil {
+			options.OnChange(Deleted, key)
+		}
+	}
+	return result, nil
+}
+
+//syncKey copies one key if required and returns the applied change (or empty string if the key is unchanged).
+func syncKey(from KV, to KV, key string, options SyncOptions) (SyncAction, error) {
+	action := Added
+	if to.Contains(key) {
+		if !options.Since.IsZero() {
+			changed, err := from.IsChanged(options.Since, key)
+			if err != nil {
+				return "", err
+			}
+			if !changed {
+				return "", nil
+			}
+		}
+		action = Updated
+	}
+	value, err := from.Get(key)
+	if err != nil {
+		return "", err
+	}
+	if action == Updated {
+		existing, err := to.Get(key)
+		if err != nil {
+			return "", err
+		}
+		if bytes.Equal(existing, value) {
+			return "", nil
+		}
+	}
+	if options.DryRun {
+		return action, nil
+	}
+	return action, to.Put(key, value)
+}
@@ -0,0 +1,51 @@
+package kv
+
+import (
+	"github.com/stretchr/testify/assert"
+	"os"
+	"sort"
+	"testing"
+)
+
+func TestSync(t *testing.T) {
+	_ = os.RemoveAll("/tmp/testx")
+	from := &DirKV{Path: "/tmp/testx"}
+	assert.Nil(t, from.Put("dir1/key1", []byte("value1")))
+	assert.Nil(t, from.Put("dir1/key2", []byte("value2")))
+	assert.Nil(t, from.Put("dir1/key3", []byte("value3")))
+
+	_ = os.Remove("/tmp/test")
+	to, err := CreateSqliteKV("/tmp/test")
+	assert.Nil(t, err)
+	defer to.Close()
+	assert.Nil(t, to.Put("dir1/key1", []byte("value1")))
+	assert.Nil(t, to.Put("dir1/key2", []byte("old")))
+	assert.Nil(t, to.Put("dir1/key4", []byte("value4")))
+
+	changes := make([]string, 0)
+	result, err := Sync(from, to, SyncOptions{
+		Delete: true,
+		DryRun: true,
+		OnChange: func(action SyncAction, key string) {
+			changes = append(changes, string(action)+" "+key)
+		},
+	})
+	assert.Nil(t, err)
+	assert.Equal(t, SyncResult{Added: 1, Updated: 1, Deleted: 1, Unchanged: 1}, result)
+	sort.Strings(changes)
+	assert.Equal(t, []string{"added dir1/key3", "deleted dir1/key4", "updated dir1/key2"}, changes)
+	assert.True(t, to.Contains("dir1/key4"))
+
+	result, err = Sync(from, to, SyncOptions{Delete: true})
+	assert.Nil(t, err)
+	assert.Equal(t, SyncResult{Added: 1, Updated: 1, Deleted: 1, Unchanged: 1}, result)
+
+	value, err := to.Get("dir1/key2")
+	assert.Nil(t, err)
+	assert.Equal(t, []byte("value2"), value)
+	assert.False(t, to.Contains("dir1/key4"))
+
+	result, err = Sync(from, to, SyncOptions{Delete: true})
+	assert.Nil(t, err)
+	assert.Equal(t, SyncResult{Unchanged: 3}, result)
+}
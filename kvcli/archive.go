@@ -0,0 +1,60 @@
+package main
+
+import (
+	"fmt"
+	"github.com/elek/go-utils/kv"
+	"io"
+	"os"
+)
+
+func export(store kv.KV, destination string) error {
+	if destination == "-" {
+		return exportTo(store, os.Stdout)
+	}
+	file, err := os.Create(destination)
+	if err != nil {
+		return err
+	}
+	err = exportTo(store, file)
+	if closeErr := file.Close(); err == nil {
+		err = closeErr
+	}
+	return err
+}
+
+func exportTo(store kv.KV, out io.Writer) error {
+	manifest, err := kv.Export(store, out)
+	if err != nil {
+		return err
+	}
+	fmt.Fprintf(os.Stderr, "Exported %d keys (%d bytes)\n", manifest.Count, manifest.Bytes)
+	return nil
+}
+
+func importArchive(source string, store kv.KV) error {
+	var in io.Reader = os.Stdin
+	if source != "-" {
+		file, err := os.Open(source)
+		if err != nil {
+			return err
+		}
+		defer file.Close()
+		in = file
+	}
+	var manifest kv.Manifest
+	var err error
+	if store == nil {
+		manifest, err = kv.Verify(in)
+	} else {
+		manifest, err = kv.Import(in, store)
+	}
+	if err != nil {
+		return err
+	}
+	if store == nil {
+		fmt.Fprintf(os.Stderr, "Archive is valid with %d keys (%d bytes)\n", manifest.Count, manifest.Bytes)
+	} else {
+		fmt.Fprintf(os.Stderr, "Imported %d keys (%d bytes)\n", manifest.Count, manifest.Bytes)
+	}
+	return nil
+}
@@ -0,0 +1,109 @@
+package main
+
+import (
+	"fmt"
+	"github.com/elek/go-utils/kv"
+	"github.com/urfave/cli/v2"
+	"io"
+	"io/ioutil"
+	"os"
+)
+
+const (
+	// exit code if the requested key doesn't exist
+	exitMissingKey = 1
+	// exit code of any other error
+	exitError = 2
+)
+
+func missingKey(key string) error {
+	return cli.Exit("No such key: "+key, exitMissingKey)
+}
+
+func get(store kv.KV, key string) error {
+	if !store.Contains(key) {
+		return missingKey(key)
+	}
+	value, err := store.Get(key)
+	if err != nil {
+		return err
+	}
+	_, err = os.Stdout.Write(value)
+	return err
+}
+
+func cat(store kv.KV, key string) error {
+	if !store.Contains(key) {
+		return missingKey(key)
+	}
+	reader, err := store.GetReader(key)
+	if err != nil {
+		return err
+	}
+	if closer, ok := reader.(io.Closer); ok {
+		defer closer.Close()
+	}
+	_, err = io.Copy(os.Stdout, reader)
+	return err
+}
+
+// put stores the value or the content of the standard input if the value is not defined (or "-")
+func put(store kv.KV, args []string) error {
+	if len(args) == 0 {
+		return cli.Exit("Key is not defined", exitError)
+	}
+	key, value := args[0], args[1:]
+	var content []byte
+	if len(value) == 0 || (len(value) == 1 && value[0] == "-") {
+		var err error
+		content, err = ioutil.ReadAll(os.Stdin)
+		if err != nil {
+			return err
+		}
+	} else if len(value) == 1 {
+		content = []byte(value[0])
+	} else {
+		return cli.Exit("Only one value can be stored", exitError)
+	}
+	return store.Put(key, content)
+}
+
+func ls(store kv.KV, prefix string, recursive bool) error {
+	if recursive {
+		return store.IterateSubTree(prefix, func(key string) error {
+			fmt.Println(key)
+			return nil
+		})
+	}
+	keys, err := store.List(prefix)
+	if err != nil {
+		return err
+	}
+	for _, key := range keys {
+		fmt.Println(key)
+	}
+	return nil
+}
+
+//rm deletes the keys. Nothing is deleted if any of the keys is missing.
+func rm(store kv.KV, keys []string) error {
+	for _, key := range keys {
+		if !store.Contains(key) {
+			return missingKey(key)
+		}
+	}
+	for _, key := range keys {
+		err := store.Delete(key)
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func exists(store kv.KV, key string) error {
+	if !store.Contains(key) {
+		return cli.Exit("", exitMissingKey)
+	}
+	return nil
+}
@@ -0,0 +1,25 @@
+package main
+
+import (
+	"github.com/elek/go-utils/kv"
+	"github.com/stretchr/testify/assert"
+	"github.com/urfave/cli/v2"
+	"testing"
+)
+
+func TestRm(t *testing.T) {
+	store := kv.CreateMemoryKV()
+	assert.Nil(t, store.Put("key1", []byte("value1")))
+	assert.Nil(t, store.Put("key2", []byte("value2")))
+
+	//nothing is deleted if a key is missing
+	err := rm(store, []string{"key1", "missing", "key2"})
+	assert.NotNil(t, err)
+	assert.Equal(t, exitMissingKey, err.(cli.ExitCoder).ExitCode())
+	assert.True(t, store.Contains("key1"))
+	assert.True(t, store.Contains("key2"))
+
+	assert.Nil(t, rm(store, []string{"key1", "key2"}))
+	assert.False(t, store.Contains("key1"))
+	assert.False(t, store.Contains("key2"))
+}
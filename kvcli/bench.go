@@ -0,0 +1,272 @@
+package main
+
+import (
+	"crypto/rand"
+	"encoding/json"
+	"fmt"
+	"github.com/elek/go-utils/kv"
+	"github.com/pkg/errors"
+	mathrand "math/rand"
+	"os"
+	"runtime"
+	"runtime/pprof"
+	"sort"
+	"sync"
+	"time"
+)
+
+type benchOptions struct {
+	Workload     string
+	Operations   int
+	Keys         int
+	Concurrency  int
+	ValueSize    int
+	ValueSizeMax int
+	ReadRatio    float64
+	CpuProfile   string
+	MemProfile   string
+	Format       string
+}
+
+type benchResult struct {
+	Workload    string  `json:"workload"`
+	Operations  int     `json:"operations"`
+	Concurrency int     `json:"concurrency"`
+	Seconds     float64 `json:"seconds"`
+	OpsPerSec   float64 `json:"ops_per_sec"`
+	Written     int64   `json:"bytes_written"`
+	Read        int64   `json:"bytes_read"`
+	//latency percentiles in milliseconds
+	Latency map[string]float64 `json:"latency_ms"`
+}
+
+//benchOperation executes the n-th operation of a worker and returns the number of written and read bytes.
+type benchOperation func(random *mathrand.Rand, n int) (int, int, error)
+
+type benchWorkerResult struct {
+	latencies []time.Duration
+	written   int64
+	read      int64
+	err       error
+}
+
+//number of the random values generated before the benchmark, the operations write one of them
+const benchValuePool = 64
+
+func benchKey(n int) string {
+	return fmt.Sprintf("key%d/%d", n/1000, n%1000)
+}
+
+func bench(store kv.KV, options benchOptions) error {
+	if options.Concurrency < 1 {
+		return errors.New("Concurrency should be at least 1")
+	}
+	if options.Keys < 1 {
+		options.Keys = options.Operations
+	}
+	values := benchValues(options)
+	operation, prepare, err := createBenchOperation(store, options, values)
+	if err != nil {
+		return err
+	}
+	if prepare {
+		err = benchPrepare(store, options, values)
+		if err != nil {
+			return errors.Wrap(err, "Couldn't prepare the keys for the benchmark")
+		}
+	}
+
+	if options.CpuProfile != "" {
+		f, err := os.Create(options.CpuProfile)
+		if err != nil {
+			return err
+		}
+		defer f.Close()
+		err = pprof.StartCPUProfile(f)
+		if err != nil {
+			return err
+		}
+	}
+	results := make([]benchWorkerResult, options.Concurrency)
+	wg := sync.WaitGroup{}
+	start := time.Now()
+	for w := 0; w < options.Concurrency; w++ {
+		wg.Add(1)
+		go func(worker int) {
+			defer wg.Done()
+			results[worker] = benchWorker(operation, worker, options)
+		}(w)
+	}
+	wg.Wait()
+	elapsed := time.Since(start)
+	if options.CpuProfile != "" {
+		pprof.StopCPUProfile()
+	}
+	if options.MemProfile != "" {
+		err = writeHeapProfile(options.MemProfile)
+		if err != nil {
+			return err
+		}
+	}
+
+	result := benchResult{
+		Workload:    options.Workload,
+		Operations:  options.Operations,
+		Concurrency: options.Concurrency,
+		Seconds:     elapsed.Seconds(),
+		OpsPerSec:   float64(options.Operations) / elapsed.Seconds(),
+	}
+	latencies := make([]time.Duration, 0, options.Operations)
+	for _, r := range results {
+		if r.err != nil {
+			return r.err
+		}
+		latencies = append(latencies, r.latencies...)
+		result.Written += r.written
+		result.Read += r.read
+	}
+	result.Latency = percentiles(latencies)
+	return printBenchResult(result, options.Format)
+}
+
+func benchWorker(operation benchOperation, worker int, options benchOptions) benchWorkerResult {
+	result := benchWorkerResult{}
+	random := mathrand.New(mathrand.NewSource(time.Now().UnixNano() + int64(worker)))
+	for n := worker; n < options.Operations; n += options.Concurrency {
+		start := time.Now()
+		written, read, err := operation(random, n)
+		result.latencies = append(result.latencies, time.Since(start))
+		if err != nil {
+			result.err = err
+			return result
+		}
+		result.written += int64(written)
+		result.read += int64(read)
+	}
+	return result
+}
+
+//createBenchOperation returns the operation of the workload and true if the keys should be written before the test
+func createBenchOperation(store kv.KV, options benchOptions, values [][]byte) (benchOperation, bool, error) {
+	put := func(random *mathrand.Rand, key string) (int, int, error) {
+		value := values[random.Intn(len(values))]
+		return len(value), 0, store.Put(key, value)
+	}
+	get := func(random *mathrand.Rand) (int, int, error) {
+		value, err := store.Get(benchKey(random.Intn(options.Keys)))
+		return 0, len(value), err
+	}
+	switch options.Workload {
+	case "seqput":
+		return func(random *mathrand.Rand, n int) (int, int, error) {
+			return put(random, benchKey(n))
+		}, false, nil
+	case "randput":
+		return func(random *mathrand.Rand, n int) (int, int, error) {
+			return put(random, benchKey(random.Intn(options.Keys)))
+		}, false, nil
+	case "get":
+		return func(random *mathrand.Rand, n int) (int, int, error) {
+			return get(random)
+		}, true, nil
+	case "list":
+		return func(random *mathrand.Rand, n int) (int, int, error) {
+			_, err := store.List(fmt.Sprintf("key%d", random.Intn(options.Keys)/1000))
+			return 0, 0, err
+		}, true, nil
+	case "iterate":
+		return func(random *mathrand.Rand, n int) (int, int, error) {
+			return 0, 0, store.IterateSubTree(fmt.Sprintf("key%d", random.Intn(options.Keys)/1000), func(key string) error {
+				return nil
+			})
+		}, true, nil
+	case "mixed":
+		return func(random *mathrand.Rand, n int) (int, int, error) {
+			if random.Float64() < options.ReadRatio {
+				return get(random)
+			}
+			return put(random, benchKey(random.Intn(options.Keys)))
+		}, true, nil
+	default:
+		return nil, false, errors.New("Unknown workload " + options.Workload)
+	}
+}
+
+func benchPrepare(store kv.KV, options benchOptions, values [][]byte) error {
+	for n := 0; n < options.Keys; n++ {
+		err := store.Put(benchKey(n), values[n%len(values)])
+		if err != nil {
+			return err
+		}
+	}
+	if sqlite, ok := store.(*kv.SqliteKV); ok {
+		return sqlite.Commit()
+	}
+	return nil
+}
+
+//benchValues returns random contents with uniformly distributed size between ValueSize and ValueSizeMax. They are
+//generated in advance to exclude the random generation from the measured latency.
+func benchValues(options benchOptions) [][]byte {
+	random := mathrand.New(mathrand.NewSource(time.Now().UnixNano()))
+	values := make([][]byte, benchValuePool)
+	for i := range values {
+		size := options.ValueSize
+		if options.ValueSizeMax > size {
+			size += random.Intn(options.ValueSizeMax - size + 1)
+		}
+		values[i] = make([]byte, size)
+		_, _ = rand.Read(values[i])
+	}
+	return values
+}
+
+func percentiles(latencies []time.Duration) map[string]float64 {
+	result := make(map[string]float64)
+	if len(latencies) == 0 {
+		return result
+	}
+	sort.Slice(latencies, func(i, j int) bool {
+		return latencies[i] < latencies[j]
+	})
+	ms := func(d time.Duration) float64 {
+		return float64(d) / float64(time.Millisecond)
+	}
+	for name, percentile := range map[string]float64{"p50": 0.50, "p90": 0.90, "p99": 0.99, "p999": 0.999} {
+		result[name] = ms(latencies[int(percentile*float64(len(latencies)-1))])
+	}
+	total := time.Duration(0)
+	for _, latency := range latencies {
+		total += latency
+	}
+	result["mean"] = ms(total / time.Duration(len(latencies)))
+	result["max"] = ms(latencies[len(latencies)-1])
+	return result
+}
+
+func printBenchResult(result benchResult, format string) error {
+	if format == "json" {
+		encoder := json.NewEncoder(os.Stdout)
+		encoder.SetIndent("", "  ")
+		return encoder.Encode(result)
+	}
+	fmt.Printf("workload:     %s\n", result.Workload)
+	fmt.Printf("operations:   %d (concurrency: %d)\n", result.Operations, result.Concurrency)
+	fmt.Printf("duration:     %.3f s\n", result.Seconds)
+	fmt.Printf("throughput:   %.1f ops/s\n", result.OpsPerSec)
+	fmt.Printf("written/read: %d / %d bytes\n", result.Written, result.Read)
+	for _, name := range []string{"mean", "p50", "p90", "p99", "p999", "max"} {
+		fmt.Printf("latency %-5s %.3f ms\n", name+":", result.Latency[name])
+	}
+	return nil
+}
+
+func writeHeapProfile(destination string) error {
+	f, err := os.Create(destination)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	runtime.GC()
+	return pprof.WriteHeapProfile(f)
+}
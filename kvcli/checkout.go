@@ -0,0 +1,212 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"github.com/elek/go-utils/kv"
+	"github.com/pkg/errors"
+	"io"
+	"io/ioutil"
+	"os"
+	"path"
+	"strings"
+	"time"
+)
+
+//name of the file (in the root of the checked out directory) which stores the checkoutState
+const checkoutStateFile = ".kvcli-checkout.json"
+
+type checkoutState struct {
+	Store  string `json:"store"`
+	Prefix string `json:"prefix"`
+	//files modified after this time are written back by checkin
+	Time time.Time `json:"time"`
+	Keys []string  `json:"keys"`
+}
+
+func readCheckoutState(dir string) (checkoutState, error) {
+	state := checkoutState{}
+	content, err := ioutil.ReadFile(path.Join(dir, checkoutStateFile))
+	if err != nil {
+		return state, errors.Wrap(err, dir+" is not a checked out kv store")
+	}
+	err = json.Unmarshal(content, &state)
+	return state, err
+}
+
+//skipReason returns why a key can't be checked out (or checked in), or an empty string if the key can be edited in a
+//directory tree
+func skipReason(key string) string {
+	if key == "" || path.IsAbs(key) || path.Clean(key) != key {
+		return "not a relative, clean path"
+	}
+	for _, segment := range strings.Split(key, "/") {
+		if segment == ".." {
+			return "path would be outside of the directory"
+		}
+		if strings.HasPrefix(segment, ".") {
+			return "hidden files are not checked in"
+		}
+	}
+	return ""
+}
+
+func writeCheckoutState(dir string, state checkoutState) error {
+	content, err := json.MarshalIndent(state, "", "  ")
+	if err != nil {
+		return err
+	}
+	return ioutil.WriteFile(path.Join(dir, checkoutStateFile), content, 0644)
+}
+
+//checkout writes the keys of the store to a directory tree which can be opened as a DirKV. Keys which can't be
+//represented as (visible) files, and the keys which are also prefixes of other keys are skipped.
+func checkout(store kv.KV, storeUrl string, dir string, prefix string, force bool, out io.Writer) error {
+	files, err := ioutil.ReadDir(dir)
+	if err == nil && len(files) > 0 && !force {
+		return errors.New(dir + " is not empty (use --force to overwrite the existing files)")
+	}
+	state := checkoutState{
+		Store:  storeUrl,
+		Prefix: prefix,
+		Time:   time.Now(),
+		Keys:   make([]string, 0),
+	}
+	//keys are collected first, to find the keys which are also prefixes (a file can't be a directory)
+	keys := make([]string, 0)
+	err = store.IterateSubTree(prefix, func(key string) error {
+		keys = append(keys, key)
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+	reasons := make(map[string]string)
+	for _, key := range keys {
+		if reason := skipReason(key); reason != "" {
+			reasons[key] = reason
+		}
+	}
+	for _, key := range keys {
+		if _, found := reasons[key]; found {
+			continue
+		}
+		for parent := path.Dir(key); parent != "."; parent = path.Dir(parent) {
+			reasons[parent] = "key is also a prefix"
+		}
+	}
+
+	destination := &kv.DirKV{Path: dir}
+	skipped := 0
+	for _, key := range keys {
+		if reason, found := reasons[key]; found {
+			fmt.Fprintf(out, "S %s (skipped: %s)\n", key, reason)
+			skipped++
+			continue
+		}
+		value, err := store.Get(key)
+		if err != nil {
+			return err
+		}
+		err = destination.Put(key, value)
+		if err != nil {
+			return errors.Wrap(err, "Couldn't write key "+key)
+		}
+		//the modification time of the unchanged files should not be after the checkout time
+		err = os.Chtimes(path.Join(dir, key), state.Time, state.Time)
+		if err != nil {
+			return err
+		}
+		state.Keys = append(state.Keys, key)
+	}
+	err = writeCheckoutState(dir, state)
+	if err != nil {
+		return err
+	}
+	fmt.Fprintf(out, "%d keys are checked out to %s, %d keys are skipped\n", len(state.Keys), dir, skipped)
+	return nil
+}
+
+//checkin writes back the files of a checked out directory which are modified (or created) since the checkout.
+//With deleteMissing, the checked out keys which are removed from the directory are deleted from the store. Hidden
+//files are reported, but not written back.
+func checkin(dir string, store kv.KV, deleteMissing bool, dryRun bool, out io.Writer) error {
+	state, err := readCheckoutState(dir)
+	if err != nil {
+		return err
+	}
+	checkinTime := time.Now()
+	source := &kv.DirKV{Path: dir}
+	written := 0
+	err = source.IterateSubTree(state.Prefix, func(key string) error {
+		if key == checkoutStateFile {
+			return nil
+		}
+		changed, err := source.IsChanged(state.Time, key)
+		if err != nil || !changed {
+			return err
+		}
+		if reason := skipReason(key); reason != "" {
+			fmt.Fprintf(out, "S %s (skipped: %s)\n", key, reason)
+			return nil
+		}
+		marker := "M"
+		if !store.Contains(key) {
+			marker = "A"
+		}
+		fmt.Fprintln(out, marker+" "+key)
+		written++
+		if dryRun {
+			return nil
+		}
+		value, err := source.Get(key)
+		if err != nil {
+			return err
+		}
+		return store.Put(key, value)
+	})
+	if err != nil {
+		return err
+	}
+	deleted := 0
+	if deleteMissing {
+		for _, key := range state.Keys {
+			if source.Contains(key) {
+				continue
+			}
+			if reason := skipReason(key); reason != "" {
+				return errors.New("Invalid key " + key + " in the checkout state: " + reason)
+			}
+			fmt.Fprintln(out, "D "+key)
+			deleted++
+			if dryRun {
+				continue
+			}
+			err = store.Delete(key)
+			if err != nil {
+				return err
+			}
+		}
+	}
+	if dryRun {
+		return nil
+	}
+	//next checkin should write only the files modified after this one
+	state.Time = checkinTime
+	state.Keys = make([]string, 0)
+	err = source.IterateSubTree(state.Prefix, func(key string) error {
+		if skipReason(key) == "" {
+			state.Keys = append(state.Keys, key)
+		}
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+	err = writeCheckoutState(dir, state)
+	if err != nil {
+		return err
+	}
+	fmt.Fprintf(out, "%d keys are written, %d keys are deleted\n", written, deleted)
+	return nil
+}
@@ -0,0 +1,129 @@
+package main
+
+import (
+	"bytes"
+	"github.com/elek/go-utils/kv"
+	"github.com/stretchr/testify/assert"
+	"io/ioutil"
+	"os"
+	"testing"
+	"time"
+)
+
+func TestSkipReason(t *testing.T) {
+	tests := []struct {
+		key     string
+		skipped bool
+	}{
+		{"issues/HDDS-1", false},
+		{"key", false},
+		{"issues/.HDDS-1.swp", true},
+		{".kvcli-checkout.json", true},
+		{"../escape", true},
+		{"issues/../../escape", true},
+		{"/etc/passwd", true},
+		{"issues//HDDS-1", true},
+		{"issues/./HDDS-1", true},
+		{"", true},
+	}
+	for _, test := range tests {
+		assert.Equal(t, test.skipped, skipReason(test.key) != "", test.key)
+	}
+}
+
+func TestCheckoutCheckin(t *testing.T) {
+	_ = os.RemoveAll("/tmp/kvclitest")
+	dir := "/tmp/kvclitest/checkout"
+	store := kv.CreateMemoryKV()
+	for key, value := range map[string]string{
+		"issues/HDDS-1":  "value1",
+		"issues/HDDS-2":  "value2",
+		"issues/.config": "hidden",
+		"../escape":      "outside",
+	} {
+		assert.Nil(t, store.Put(key, []byte(value)))
+	}
+
+	out := bytes.Buffer{}
+	assert.Nil(t, checkout(store, "mem:", dir, "", false, &out))
+	assert.Contains(t, out.String(), "S ../escape")
+	assert.Contains(t, out.String(), "S issues/.config")
+	assert.Contains(t, out.String(), "2 keys are checked out")
+	_, err := os.Stat("/tmp/kvclitest/escape")
+	assert.True(t, os.IsNotExist(err))
+	assert.NotNil(t, checkout(store, "mem:", dir, "", false, &out))
+
+	//modification times are set explicitly to be independent of the file system resolution
+	modified := time.Now().Add(time.Minute)
+	for file, content := range map[string]string{
+		"issues/HDDS-1":      "changed",
+		"issues/HDDS-3":      "new",
+		"issues/.HDDS-1.swp": "swap",
+	} {
+		assert.Nil(t, ioutil.WriteFile(dir+"/"+file, []byte(content), 0644))
+		assert.Nil(t, os.Chtimes(dir+"/"+file, modified, modified))
+	}
+	assert.Nil(t, os.Remove(dir+"/issues/HDDS-2"))
+
+	tests := []struct {
+		name     string
+		dryRun   bool
+		expected map[string]string
+	}{
+		{
+			name:   "dry run",
+			dryRun: true,
+			expected: map[string]string{
+				"issues/HDDS-1": "value1",
+				"issues/HDDS-2": "value2",
+			},
+		},
+		{
+			name: "checkin",
+			expected: map[string]string{
+				"issues/HDDS-1": "changed",
+				"issues/HDDS-3": "new",
+			},
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			out := bytes.Buffer{}
+			assert.Nil(t, checkin(dir, store, true, test.dryRun, &out))
+			assert.Contains(t, out.String(), "M issues/HDDS-1\n")
+			assert.Contains(t, out.String(), "A issues/HDDS-3\n")
+			assert.Contains(t, out.String(), "D issues/HDDS-2\n")
+			assert.Contains(t, out.String(), "S issues/.HDDS-1.swp")
+			for key, value := range test.expected {
+				content, err := store.Get(key)
+				assert.Nil(t, err)
+				assert.Equal(t, value, string(content))
+			}
+			assert.False(t, store.Contains("issues/.HDDS-1.swp"))
+		})
+	}
+	assert.False(t, store.Contains("issues/HDDS-2"))
+	assert.True(t, store.Contains("issues/.config"))
+}
+
+func TestCheckoutKeyAndPrefix(t *testing.T) {
+	_ = os.RemoveAll("/tmp/kvclitest")
+	dir := "/tmp/kvclitest/checkout"
+	store := kv.CreateMemoryKV()
+	for _, key := range []string{"a", "a/b", "a/b/c", "d"} {
+		assert.Nil(t, store.Put(key, []byte("value of "+key)))
+	}
+
+	out := bytes.Buffer{}
+	assert.Nil(t, checkout(store, "mem:", dir, "", false, &out))
+	assert.Contains(t, out.String(), "S a (skipped: key is also a prefix)\n")
+	assert.Contains(t, out.String(), "S a/b (skipped: key is also a prefix)\n")
+	assert.Contains(t, out.String(), "2 keys are checked out to "+dir+", 2 keys are skipped\n")
+
+	state, err := readCheckoutState(dir)
+	assert.Nil(t, err)
+	assert.Equal(t, []string{"a/b/c", "d"}, state.Keys)
+	content, err := ioutil.ReadFile(dir + "/a/b/c")
+	assert.Nil(t, err)
+	assert.Equal(t, "value of a/b/c", string(content))
+}
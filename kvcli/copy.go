@@ -0,0 +1,258 @@
+package main
+
+import (
+	"encoding/json"
+	"github.com/elek/go-utils"
+	"github.com/elek/go-utils/kv"
+	"github.com/pkg/errors"
+	"github.com/rs/zerolog/log"
+	"io/ioutil"
+	"os"
+	"sync"
+	"time"
+)
+
+//period of the checkpoint writes during the copy
+const checkpointInterval = 5 * time.Second
+
+type copyOptions struct {
+	Workers    int
+	BatchSize  int
+	Checkpoint string
+	Resume     bool
+}
+
+//copyCheckpoint is the state of an interrupted copy: the first Copied keys of the iteration (the last one is Key) are
+//already written to the destination. The copy is resumed after Key, which relies on the deterministic order of
+//IterateAll.
+type copyCheckpoint struct {
+	From   string `json:"from"`
+	To     string `json:"to"`
+	Copied int    `json:"copied"`
+	Key    string `json:"key"`
+}
+
+//copyTracker follows the completion of the keys (identified by their position in the iteration) which are copied in
+//random order by the workers, to find the longest fully copied part of the iteration.
+type copyTracker struct {
+	lock      sync.Mutex
+	completed map[int]string
+	next      int
+	lastKey   string
+}
+
+func (t *copyTracker) done(index int, key string) {
+	t.lock.Lock()
+	defer t.lock.Unlock()
+	t.completed[index] = key
+	for {
+		key, found := t.completed[t.next]
+		if !found {
+			return
+		}
+		delete(t.completed, t.next)
+		t.lastKey = key
+		t.next++
+	}
+}
+
+func (t *copyTracker) state() (int, string) {
+	t.lock.Lock()
+	defer t.lock.Unlock()
+	return t.next, t.lastKey
+}
+
+type copyJob struct {
+	index int
+	key   string
+}
+
+func readCopyCheckpoint(file string) (copyCheckpoint, error) {
+	checkpoint := copyCheckpoint{}
+	content, err := ioutil.ReadFile(file)
+	if err != nil {
+		return checkpoint, errors.Wrap(err, "Couldn't read the checkpoint of the copy")
+	}
+	err = json.Unmarshal(content, &checkpoint)
+	return checkpoint, err
+}
+
+func writeCopyCheckpoint(file string, checkpoint copyCheckpoint) error {
+	content, err := json.Marshal(checkpoint)
+	if err != nil {
+		return err
+	}
+	tmp := file + ".tmp"
+	err = ioutil.WriteFile(tmp, content, 0644)
+	if err != nil {
+		return err
+	}
+	return os.Rename(tmp, file)
+}
+
+//copyStore copies all the keys with parallel workers. If a checkpoint file is defined, the progress is saved to it
+//periodically, and an interrupted copy can be continued with the Resume option.
+func copyStore(from kv.KV, to kv.KV, fromUrl string, toUrl string, options copyOptions) error {
+	if options.Workers < 1 {
+		return errors.New("Number of workers should be at least 1")
+	}
+	if options.Resume && options.Checkpoint == "" {
+		return errors.New("Checkpoint file should be defined to resume a copy")
+	}
+	skip := 0
+	lastKey := ""
+	if options.Resume {
+		checkpoint, err := readCopyCheckpoint(options.Checkpoint)
+		if err != nil {
+			return err
+		}
+		if checkpoint.From != fromUrl || checkpoint.To != toUrl {
+			return errors.New("Checkpoint " + options.Checkpoint + " belongs to the copy from " + checkpoint.From + " to " + checkpoint.To)
+		}
+		skip = checkpoint.Copied
+		lastKey = checkpoint.Key
+		log.Info().Msgf("Resuming the copy after %d keys (%s)", skip, checkpoint.Key)
+	}
+	batcher, batched := to.(kv.Batcher)
+	if batched && options.BatchSize > 0 {
+		batcher.SetBatchSize(options.BatchSize)
+	}
+	p := util.CreateProgress()
+	if counter, ok := from.(kv.Counter); ok {
+		total, err := counter.Count("")
+		if err != nil {
+			return err
+		}
+		p = util.CreateProgressWithTotal(total - skip)
+	}
+
+	tracker := &copyTracker{
+		completed: make(map[int]string),
+		next:      skip,
+		lastKey:   lastKey,
+	}
+	//the destination batch is committed before the checkpoint, to persist all the copied keys
+	saveCheckpoint := func() error {
+		if options.Checkpoint == "" {
+			return nil
+		}
+		copied, key := tracker.state()
+		if batched {
+			err := batcher.Commit()
+			if err != nil {
+				return err
+			}
+		}
+		return writeCopyCheckpoint(options.Checkpoint, copyCheckpoint{
+			From:   fromUrl,
+			To:     toUrl,
+			Copied: copied,
+			Key:    key,
+		})
+	}
+
+	jobs := make(chan copyJob, options.Workers*16)
+	done := make(chan struct{})
+	var failure error
+	failureOnce := sync.Once{}
+	fail := func(err error) {
+		failureOnce.Do(func() {
+			failure = err
+			close(done)
+		})
+	}
+
+	workers := sync.WaitGroup{}
+	for i := 0; i < options.Workers; i++ {
+		workers.Add(1)
+		go func() {
+			defer workers.Done()
+			for job := range jobs {
+				value, err := from.Get(job.key)
+				if err != nil {
+					fail(errors.Wrap(err, "Couldn't read key "+job.key))
+					return
+				}
+				err = to.Put(job.key, value)
+				if err != nil {
+					fail(errors.Wrap(err, "Couldn't write key "+job.key))
+					return
+				}
+				tracker.done(job.index, job.key)
+				p.Increment()
+			}
+		}()
+	}
+
+	stopCheckpoints := make(chan struct{})
+	checkpoints := sync.WaitGroup{}
+	if options.Checkpoint != "" {
+		checkpoints.Add(1)
+		go func() {
+			defer checkpoints.Done()
+			ticker := time.NewTicker(checkpointInterval)
+			defer ticker.Stop()
+			for {
+				select {
+				case <-ticker.C:
+					err := saveCheckpoint()
+					if err != nil {
+						fail(errors.Wrap(err, "Couldn't save the checkpoint"))
+						return
+					}
+				case <-stopCheckpoints:
+					return
+				}
+			}
+		}()
+	}
+
+	//keys are skipped until the last copied key of the checkpoint
+	skipping := skip > 0
+	index := skip
+	err := from.IterateAll(func(key string) error {
+		if skipping {
+			skipping = key != lastKey
+			return nil
+		}
+		current := index
+		index++
+		select {
+		case jobs <- copyJob{index: current, key: key}:
+			return nil
+		case <-done:
+			return failure
+		}
+	})
+	close(jobs)
+	workers.Wait()
+	close(stopCheckpoints)
+	checkpoints.Wait()
+	p.End()
+	if err == nil {
+		err = failure
+	}
+	if err == nil && skipping {
+		err = errors.New("Key " + lastKey + " of the checkpoint is missing from the source, the copy can't be resumed")
+	}
+	if err != nil {
+		if checkpointErr := saveCheckpoint(); checkpointErr != nil {
+			log.Error().Err(checkpointErr).Msg("Couldn't save the checkpoint")
+		}
+		return err
+	}
+	if batched {
+		err = batcher.Commit()
+		if err != nil {
+			return err
+		}
+	}
+	if options.Checkpoint == "" {
+		return nil
+	}
+	err = os.Remove(options.Checkpoint)
+	if os.IsNotExist(err) {
+		return nil
+	}
+	return err
+}
@@ -0,0 +1,97 @@
+package main
+
+import (
+	"github.com/elek/go-utils/kv"
+	"github.com/stretchr/testify/assert"
+	"os"
+	"testing"
+)
+
+func TestCopyResume(t *testing.T) {
+	_ = os.RemoveAll("/tmp/kvclitest")
+	_ = os.MkdirAll("/tmp/kvclitest", 0755)
+	checkpointFile := "/tmp/kvclitest/copy.checkpoint"
+	keys := []string{"a/1", "a/2", "b/1", "b/2", "c"}
+	tests := []struct {
+		name       string
+		checkpoint *copyCheckpoint
+		options    copyOptions
+		copied     []string
+		err        bool
+	}{
+		{
+			name:    "without checkpoint",
+			options: copyOptions{Workers: 2},
+			copied:  keys,
+		},
+		{
+			name:    "with checkpoint",
+			options: copyOptions{Workers: 2, Checkpoint: checkpointFile},
+			copied:  keys,
+		},
+		{
+			name:       "resume",
+			checkpoint: &copyCheckpoint{From: "from", To: "to", Copied: 3, Key: "b/1"},
+			options:    copyOptions{Workers: 2, Checkpoint: checkpointFile, Resume: true},
+			copied:     []string{"b/2", "c"},
+		},
+		{
+			name:       "resume after the last key",
+			checkpoint: &copyCheckpoint{From: "from", To: "to", Copied: 5, Key: "c"},
+			options:    copyOptions{Workers: 2, Checkpoint: checkpointFile, Resume: true},
+			copied:     []string{},
+		},
+		{
+			name:       "resume with missing key",
+			checkpoint: &copyCheckpoint{From: "from", To: "to", Copied: 3, Key: "b/0"},
+			options:    copyOptions{Workers: 2, Checkpoint: checkpointFile, Resume: true},
+			err:        true,
+		},
+		{
+			name:       "resume other copy",
+			checkpoint: &copyCheckpoint{From: "other", To: "to", Copied: 3, Key: "b/1"},
+			options:    copyOptions{Workers: 2, Checkpoint: checkpointFile, Resume: true},
+			err:        true,
+		},
+		{
+			name:    "resume without checkpoint file",
+			options: copyOptions{Workers: 2, Resume: true},
+			err:     true,
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			from := kv.CreateMemoryKV()
+			for _, key := range keys {
+				assert.Nil(t, from.Put(key, []byte("value of "+key)))
+			}
+			to := kv.CreateMemoryKV()
+			_ = os.Remove(checkpointFile)
+			if test.checkpoint != nil {
+				assert.Nil(t, writeCopyCheckpoint(checkpointFile, *test.checkpoint))
+			}
+
+			err := copyStore(from, to, "from", "to", test.options)
+			if test.err {
+				assert.NotNil(t, err)
+				return
+			}
+			assert.Nil(t, err)
+
+			copied := make([]string, 0)
+			assert.Nil(t, to.IterateAll(func(key string) error {
+				copied = append(copied, key)
+				value, err := to.Get(key)
+				assert.Nil(t, err)
+				assert.Equal(t, "value of "+key, string(value))
+				return nil
+			}))
+			assert.Equal(t, test.copied, copied)
+
+			_, err = os.Stat(checkpointFile)
+			assert.True(t, os.IsNotExist(err))
+			_, err = os.Stat(".kvcli-copy.checkpoint")
+			assert.True(t, os.IsNotExist(err))
+		})
+	}
+}
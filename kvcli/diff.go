@@ -0,0 +1,69 @@
+package main
+
+import (
+	gojson "encoding/json"
+	"fmt"
+	"github.com/elek/go-utils/json"
+	"github.com/elek/go-utils/kv"
+	"github.com/pkg/errors"
+	"github.com/urfave/cli/v2"
+	"os"
+)
+
+var diffMarkers = map[kv.DifferenceType]string{
+	kv.OnlyInFirst:  "<",
+	kv.OnlyInSecond: ">",
+	kv.Different:    "!",
+}
+
+type diffRecord struct {
+	Key     string            `json:"key"`
+	Type    kv.DifferenceType `json:"type"`
+	Changes []string          `json:"changes,omitempty"`
+}
+
+func diff(first kv.KV, second kv.KV, prefix string, showValues bool, format string) error {
+	if format != "text" && format != "json" {
+		return errors.New("Unsupported output format " + format)
+	}
+	encoder := gojson.NewEncoder(os.Stdout)
+	differences := 0
+	err := kv.Compare(first, second, prefix, func(difference kv.Difference) error {
+		differences++
+		record := diffRecord{
+			Key:  difference.Key,
+			Type: difference.Type,
+		}
+		if showValues && difference.Type == kv.Different {
+			record.Changes = valueChanges(difference.First, difference.Second)
+		}
+		if format == "json" {
+			return encoder.Encode(record)
+		}
+		fmt.Println(diffMarkers[difference.Type] + " " + difference.Key)
+		for _, change := range record.Changes {
+			fmt.Println("    " + change)
+		}
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+	if differences > 0 {
+		return cli.Exit("", 1)
+	}
+	return nil
+}
+
+//valueChanges returns the changed JSON fields, or a generic message if the values are not JSON documents
+func valueChanges(first []byte, second []byte) []string {
+	var firstJson, secondJson interface{}
+	if gojson.Unmarshal(first, &firstJson) != nil || gojson.Unmarshal(second, &secondJson) != nil {
+		return []string{fmt.Sprintf("values are different (%d bytes -> %d bytes)", len(first), len(second))}
+	}
+	changes := json.Diff(firstJson, secondJson)
+	if len(changes) == 0 {
+		return []string{"values are equivalent JSON documents with different formatting"}
+	}
+	return changes
+}
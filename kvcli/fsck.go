@@ -0,0 +1,28 @@
+package main
+
+import (
+	"fmt"
+	"github.com/elek/go-utils/kv"
+	"github.com/urfave/cli/v2"
+)
+
+func fsck(store kv.KV, options kv.CheckOptions) error {
+	problems, err := kv.Check(store, options)
+	if err != nil {
+		return err
+	}
+	unrepaired := 0
+	for _, problem := range problems {
+		status := ""
+		if problem.Repaired {
+			status = " [repaired]"
+		} else {
+			unrepaired++
+		}
+		fmt.Printf("%s: %s%s\n", problem.Key, problem.Description, status)
+	}
+	if unrepaired > 0 {
+		return cli.Exit(fmt.Sprintf("%d problem(s) found, %d repaired", len(problems), len(problems)-unrepaired), 1)
+	}
+	return nil
+}
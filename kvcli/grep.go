@@ -0,0 +1,202 @@
+package main
+
+import (
+	gojson "encoding/json"
+	"fmt"
+	"github.com/elek/go-utils/json"
+	"github.com/elek/go-utils/kv"
+	"github.com/pkg/errors"
+	"io"
+	"regexp"
+	"strings"
+	"sync"
+)
+
+type grepOptions struct {
+	Prefix     string
+	JsonPath   string
+	Workers    int
+	Context    int
+	IgnoreCase bool
+	KeysOnly   bool
+}
+
+type grepMatch struct {
+	key      string
+	snippets []string
+}
+
+//jsonPathFilter matches JSON documents where the value of the dot separated path is equal to the expected value
+type jsonPathFilter struct {
+	path     []string
+	expected string
+	//without expected value, any non-null value is accepted
+	exists bool
+}
+
+func parseJsonPath(expression string) jsonPathFilter {
+	parts := strings.SplitN(expression, "=", 2)
+	filter := jsonPathFilter{
+		path:   strings.Split(parts[0], "."),
+		exists: len(parts) == 1,
+	}
+	if len(parts) == 2 {
+		filter.expected = parts[1]
+	}
+	return filter
+}
+
+func (f jsonPathFilter) match(document interface{}) (string, bool) {
+	value := json.M(document, f.path...)
+	if value == nil {
+		return "", false
+	}
+	if f.exists {
+		if text, ok := value.(string); ok {
+			return text, true
+		}
+		content, _ := gojson.Marshal(value)
+		return string(content), true
+	}
+	if list, ok := value.([]interface{}); ok {
+		for _, element := range list {
+			if fmt.Sprint(element) == f.expected {
+				return f.expected, true
+			}
+		}
+		return "", false
+	}
+	return f.expected, fmt.Sprint(value) == f.expected
+}
+
+//grep prints the keys where the value matches the pattern and/or the JSON path filter. The values are read and
+//matched by options.Workers goroutines, therefore the order of the keys is not guaranteed.
+func grep(store kv.KV, pattern string, options grepOptions, out io.Writer) error {
+	if pattern == "" && options.JsonPath == "" {
+		return errors.New("Either a pattern or a --json-path should be defined")
+	}
+	if options.Workers < 1 {
+		return errors.New("Number of workers should be at least 1")
+	}
+	var expression *regexp.Regexp
+	if pattern != "" {
+		if options.IgnoreCase {
+			pattern = "(?i)" + pattern
+		}
+		var err error
+		expression, err = regexp.Compile(pattern)
+		if err != nil {
+			return errors.Wrap(err, "Invalid pattern")
+		}
+	}
+	var filter *jsonPathFilter
+	if options.JsonPath != "" {
+		parsed := parseJsonPath(options.JsonPath)
+		filter = &parsed
+	}
+
+	keys := make(chan string, options.Workers*16)
+	matches := make(chan grepMatch, options.Workers*16)
+	done := make(chan struct{})
+	var failure error
+	failureOnce := sync.Once{}
+	fail := func(err error) {
+		failureOnce.Do(func() {
+			failure = err
+			close(done)
+		})
+	}
+
+	workers := sync.WaitGroup{}
+	for i := 0; i < options.Workers; i++ {
+		workers.Add(1)
+		go func() {
+			defer workers.Done()
+			for key := range keys {
+				value, err := store.Get(key)
+				if err != nil {
+					fail(errors.Wrap(err, "Couldn't read key "+key))
+					return
+				}
+				match, found := grepValue(key, value, expression, filter, options.Context)
+				if found {
+					matches <- match
+				}
+			}
+		}()
+	}
+
+	printed := make(chan struct{})
+	go func() {
+		defer close(printed)
+		for match := range matches {
+			if options.KeysOnly || len(match.snippets) == 0 {
+				fmt.Fprintln(out, match.key)
+				continue
+			}
+			for _, snippet := range match.snippets {
+				fmt.Fprintln(out, match.key+": "+snippet)
+			}
+		}
+	}()
+
+	err := store.IterateSubTree(options.Prefix, func(key string) error {
+		select {
+		case keys <- key:
+			return nil
+		case <-done:
+			return failure
+		}
+	})
+	close(keys)
+	workers.Wait()
+	close(matches)
+	<-printed
+	if err != nil {
+		return err
+	}
+	return failure
+}
+
+func grepValue(key string, value []byte, expression *regexp.Regexp, filter *jsonPathFilter, context int) (grepMatch, bool) {
+	match := grepMatch{key: key}
+	if filter != nil {
+		var document interface{}
+		if gojson.Unmarshal(value, &document) != nil {
+			return match, false
+		}
+		matched, found := filter.match(document)
+		if !found {
+			return match, false
+		}
+		match.snippets = append(match.snippets, strings.Join(filter.path, ".")+"="+matched)
+	}
+	if expression != nil {
+		locations := expression.FindAllIndex(value, -1)
+		if len(locations) == 0 {
+			return match, false
+		}
+		for _, location := range locations {
+			match.snippets = append(match.snippets, snippet(value, location[0], location[1], context))
+		}
+	}
+	return match, true
+}
+
+//snippet returns the matched part of the value with context characters around it, on a single line
+func snippet(value []byte, start int, end int, context int) string {
+	from := start - context
+	prefix := "..."
+	if from <= 0 {
+		from = 0
+		prefix = ""
+	}
+	to := end + context
+	suffix := "..."
+	if to >= len(value) {
+		to = len(value)
+		suffix = ""
+	}
+	result := strings.ToValidUTF8(string(value[from:to]), "")
+	return prefix + strings.Join(strings.Fields(result), " ") + suffix
+}
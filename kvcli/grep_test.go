@@ -0,0 +1,89 @@
+package main
+
+import (
+	"bytes"
+	"github.com/elek/go-utils/kv"
+	"github.com/stretchr/testify/assert"
+	"sort"
+	"strings"
+	"testing"
+)
+
+func TestGrep(t *testing.T) {
+	store := kv.CreateMemoryKV()
+	for key, value := range map[string]string{
+		"issues/HDDS-1":  `{"key":"HDDS-1","fields":{"status":"Open","labels":["ozone","bug"]},"summary":"Datanode fails to start"}`,
+		"issues/HDDS-2":  `{"key":"HDDS-2","fields":{"status":"Resolved","labels":["ozone"]},"summary":"Fix the datanode report"}`,
+		"issues/RATIS-1": `{"key":"RATIS-1","fields":{"status":"Open"},"summary":"Leader election"}`,
+		"pulls/1":        "plain text with Datanode",
+	} {
+		assert.Nil(t, store.Put(key, []byte(value)))
+	}
+
+	tests := []struct {
+		name     string
+		pattern  string
+		options  grepOptions
+		expected []string
+	}{
+		{
+			name:     "pattern",
+			pattern:  "Datanode",
+			options:  grepOptions{KeysOnly: true},
+			expected: []string{"issues/HDDS-1", "pulls/1"},
+		},
+		{
+			name:     "ignore case",
+			pattern:  "datanode",
+			options:  grepOptions{KeysOnly: true, IgnoreCase: true},
+			expected: []string{"issues/HDDS-1", "issues/HDDS-2", "pulls/1"},
+		},
+		{
+			name:     "prefix",
+			pattern:  "Datanode",
+			options:  grepOptions{KeysOnly: true, Prefix: "pulls"},
+			expected: []string{"pulls/1"},
+		},
+		{
+			name:     "snippet with context",
+			pattern:  "with",
+			options:  grepOptions{Context: 3},
+			expected: []string{"pulls/1: ...xt with Da..."},
+		},
+		{
+			name:     "json path value",
+			options:  grepOptions{JsonPath: "fields.status=Open"},
+			expected: []string{"issues/HDDS-1: fields.status=Open", "issues/RATIS-1: fields.status=Open"},
+		},
+		{
+			name:     "json path list element",
+			options:  grepOptions{JsonPath: "fields.labels=bug", KeysOnly: true},
+			expected: []string{"issues/HDDS-1"},
+		},
+		{
+			name:     "json path exists",
+			options:  grepOptions{JsonPath: "fields.labels"},
+			expected: []string{`issues/HDDS-1: fields.labels=["ozone","bug"]`, `issues/HDDS-2: fields.labels=["ozone"]`},
+		},
+		{
+			name:     "json path and pattern",
+			pattern:  "Leader",
+			options:  grepOptions{JsonPath: "fields.status=Open", KeysOnly: true},
+			expected: []string{"issues/RATIS-1"},
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			out := bytes.Buffer{}
+			test.options.Workers = 2
+			assert.Nil(t, grep(store, test.pattern, test.options, &out))
+			lines := strings.Split(strings.TrimSpace(out.String()), "\n")
+			sort.Strings(lines)
+			assert.Equal(t, test.expected, lines)
+		})
+	}
+
+	assert.NotNil(t, grep(store, "", grepOptions{Workers: 1}, &bytes.Buffer{}))
+	assert.NotNil(t, grep(store, "[", grepOptions{Workers: 1}, &bytes.Buffer{}))
+	assert.NotNil(t, grep(store, "a", grepOptions{}, &bytes.Buffer{}))
+}
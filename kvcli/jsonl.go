@@ -0,0 +1,28 @@
+package main
+
+import (
+	"bufio"
+	"fmt"
+	"github.com/elek/go-utils/kv"
+	"github.com/pkg/errors"
+	"os"
+)
+
+func dump(store kv.KV, format string, exact bool, prefixes []string) error {
+	if format != "jsonl" {
+		return errors.New("Unsupported dump format " + format)
+	}
+	out := bufio.NewWriter(os.Stdout)
+	counter, err := kv.DumpJsonLines(store, out, exact, prefixes...)
+	if err != nil {
+		return err
+	}
+	fmt.Fprintf(os.Stderr, "Dumped %d keys\n", counter)
+	return out.Flush()
+}
+
+func load(store kv.KV, prefixes []string) error {
+	counter, err := kv.LoadJsonLines(bufio.NewReader(os.Stdin), store, prefixes...)
+	fmt.Fprintf(os.Stderr, "Loaded %d keys\n", counter)
+	return err
+}
@@ -1,13 +1,13 @@
 package main
 
 import (
-	"crypto/rand"
+	"fmt"
 	util "github.com/elek/go-utils"
 	"github.com/elek/go-utils/kv"
+	"github.com/rs/zerolog/log"
+	"net/http"
 	"os"
-	"runtime"
-	"runtime/pprof"
-	"strconv"
+	"time"
 )
 import "github.com/urfave/cli/v2"
 
@@ -17,20 +17,415 @@ func main() {
 		Usage: "Utility for lightweight KV stores",
 		Commands: []*cli.Command{
 			{
-				Name:    "copy",
-				Aliases: []string{"cp"},
-				Usage:   "Copy keys from one kv store to an other",
+				Name:      "copy",
+				Aliases:   []string{"cp"},
+				Usage:     "Copy keys from one kv store to an other",
+				ArgsUsage: "<from> <to>",
+				Flags: []cli.Flag{
+					&cli.IntFlag{
+						Name:  "workers",
+						Value: 4,
+						Usage: "Number of goroutines copying the keys",
+					},
+					&cli.IntFlag{
+						Name:  "batch",
+						Value: 1000,
+						Usage: "Number of writes committed together (if the destination supports batches)",
+					},
+					&cli.StringFlag{
+						Name:  "checkpoint",
+						Usage: "File to save the progress of the copy (required by --resume)",
+					},
+					&cli.BoolFlag{
+						Name:  "resume",
+						Usage: "Continue an interrupted copy from the checkpoint",
+					},
+				},
+				Action: func(c *cli.Context) error {
+					from, err := kv.Create(c.Args().Get(0))
+					if err != nil {
+						return err
+					}
+					defer from.Close()
+					to, err := kv.Create(c.Args().Get(1))
+					if err != nil {
+						return err
+					}
+					defer to.Close()
+					return copyStore(from, to, c.Args().Get(0), c.Args().Get(1), copyOptions{
+						Workers:    c.Int("workers"),
+						BatchSize:  c.Int("batch"),
+						Checkpoint: c.String("checkpoint"),
+						Resume:     c.Bool("resume"),
+					})
+				},
+			},
+			{
+				Name:      "sync",
+				Usage:     "Copy only the new and changed keys from one kv store to an other",
+				ArgsUsage: "<from> <to>",
+				Flags: []cli.Flag{
+					&cli.StringFlag{
+						Name:  "prefix",
+						Usage: "Sync only the keys with this prefix",
+					},
+					&cli.BoolFlag{
+						Name:  "delete",
+						Usage: "Delete the keys from the destination which are missing from the source",
+					},
+					&cli.BoolFlag{
+						Name:  "dry-run",
+						Usage: "Print the changes without modifying the destination",
+					},
+					&cli.TimestampFlag{
+						Name:   "since",
+						Usage:  "Compare values only if the source reports modification after this time",
+						Layout: time.RFC3339,
+					},
+				},
 				Action: func(c *cli.Context) error {
 					from, err := kv.Create(c.Args().Get(0))
 					if err != nil {
 						return err
 					}
+					defer from.Close()
 					to, err := kv.Create(c.Args().Get(1))
 					if err != nil {
 						return err
 					}
-					copy(from, to)
-					return nil
+					defer to.Close()
+					options := kv.SyncOptions{
+						Prefix: c.String("prefix"),
+						Delete: c.Bool("delete"),
+						DryRun: c.Bool("dry-run"),
+					}
+					if since := c.Timestamp("since"); since != nil {
+						options.Since = *since
+					}
+					return syncStores(from, to, options)
+				},
+			},
+			{
+				Name:      "get",
+				Usage:     "Print the value of a key",
+				ArgsUsage: "<store> <key>",
+				Action: func(c *cli.Context) error {
+					store, err := kv.Create(c.Args().Get(0))
+					if err != nil {
+						return err
+					}
+					defer store.Close()
+					return get(store, c.Args().Get(1))
+				},
+			},
+			{
+				Name:      "put",
+				Usage:     "Store a value (from the argument or from the standard input)",
+				ArgsUsage: "<store> <key> [value or -]",
+				Action: func(c *cli.Context) error {
+					store, err := kv.Create(c.Args().Get(0))
+					if err != nil {
+						return err
+					}
+					defer store.Close()
+					return put(store, c.Args().Tail())
+				},
+			},
+			{
+				Name:      "ls",
+				Usage:     "List the keys and sub-prefixes under a prefix",
+				ArgsUsage: "<store> [prefix]",
+				Flags: []cli.Flag{
+					&cli.BoolFlag{
+						Name:    "recursive",
+						Aliases: []string{"r"},
+						Usage:   "List all the keys of the sub-prefixes",
+					},
+				},
+				Action: func(c *cli.Context) error {
+					store, err := kv.Create(c.Args().Get(0))
+					if err != nil {
+						return err
+					}
+					defer store.Close()
+					return ls(store, c.Args().Get(1), c.Bool("recursive"))
+				},
+			},
+			{
+				Name:      "rm",
+				Usage:     "Delete keys from a kv store",
+				ArgsUsage: "<store> <key>...",
+				Action: func(c *cli.Context) error {
+					store, err := kv.Create(c.Args().Get(0))
+					if err != nil {
+						return err
+					}
+					defer store.Close()
+					return rm(store, c.Args().Tail())
+				},
+			},
+			{
+				Name:      "cat",
+				Usage:     "Stream the value of a key to the standard output",
+				ArgsUsage: "<store> <key>",
+				Action: func(c *cli.Context) error {
+					store, err := kv.Create(c.Args().Get(0))
+					if err != nil {
+						return err
+					}
+					defer store.Close()
+					return cat(store, c.Args().Get(1))
+				},
+			},
+			{
+				Name:      "exists",
+				Usage:     "Exit with zero exit code if the key exists",
+				ArgsUsage: "<store> <key>",
+				Action: func(c *cli.Context) error {
+					store, err := kv.Create(c.Args().Get(0))
+					if err != nil {
+						return err
+					}
+					defer store.Close()
+					return exists(store, c.Args().Get(1))
+				},
+			},
+			{
+				Name:      "diff",
+				Usage:     "Compare the keys and values of two kv stores",
+				ArgsUsage: "<first> <second>",
+				Flags: []cli.Flag{
+					&cli.StringFlag{
+						Name:  "prefix",
+						Usage: "Compare only the keys with this prefix",
+					},
+					&cli.BoolFlag{
+						Name:  "values",
+						Usage: "Show the changed fields of the different JSON values",
+					},
+					&cli.StringFlag{
+						Name:  "format",
+						Value: "text",
+						Usage: "Output format (text or json)",
+					},
+				},
+				Action: func(c *cli.Context) error {
+					first, err := kv.Create(c.Args().Get(0))
+					if err != nil {
+						return err
+					}
+					defer first.Close()
+					second, err := kv.Create(c.Args().Get(1))
+					if err != nil {
+						return err
+					}
+					defer second.Close()
+					return diff(first, second, c.String("prefix"), c.Bool("values"), c.String("format"))
+				},
+			},
+			{
+				Name:      "serve",
+				Usage:     "Expose a kv store over HTTP",
+				ArgsUsage: "<store>",
+				Flags: []cli.Flag{
+					&cli.StringFlag{
+						Name:  "listen",
+						Value: "127.0.0.1:8080",
+						Usage: "Address to listen on",
+					},
+					&cli.BoolFlag{
+						Name:  "writable",
+						Usage: "Accept PUT and DELETE requests (without authentication), the store is read-only by default",
+					},
+				},
+				Action: func(c *cli.Context) error {
+					store, err := kv.Create(c.Args().Get(0))
+					if err != nil {
+						return err
+					}
+					defer store.Close()
+					handler := kv.NewReadOnlyHandler(store)
+					if c.Bool("writable") {
+						handler = kv.NewHandler(store)
+					}
+					log.Info().Msgf("Serving %s on %s (writable: %t)", c.Args().Get(0), c.String("listen"), c.Bool("writable"))
+					return http.ListenAndServe(c.String("listen"), handler)
+				},
+			},
+			{
+				Name:      "fsck",
+				Aliases:   []string{"verify"},
+				Usage:     "Check the integrity of a kv store",
+				ArgsUsage: "<store>",
+				Flags: []cli.Flag{
+					&cli.BoolFlag{
+						Name:  "repair",
+						Usage: "Fix the problems where it's possible",
+					},
+					&cli.BoolFlag{
+						Name:  "json",
+						Usage: "Report the values which are not valid JSON documents",
+					},
+				},
+				Action: func(c *cli.Context) error {
+					store, err := kv.Create(c.Args().Get(0))
+					if err != nil {
+						return err
+					}
+					defer store.Close()
+					return fsck(store, kv.CheckOptions{
+						Repair: c.Bool("repair"),
+						Json:   c.Bool("json"),
+					})
+				},
+			},
+			{
+				Name:      "stats",
+				Aliases:   []string{"du"},
+				Usage:     "Report the number and size of the keys per prefix",
+				ArgsUsage: "<store> [prefix]",
+				Flags: []cli.Flag{
+					&cli.IntFlag{
+						Name:  "depth",
+						Value: 2,
+						Usage: "Depth of the reported prefix tree",
+					},
+					&cli.IntFlag{
+						Name:  "top",
+						Value: 10,
+						Usage: "Number of the largest keys to report",
+					},
+					&cli.StringFlag{
+						Name:  "format",
+						Value: "text",
+						Usage: "Output format (text or json)",
+					},
+				},
+				Action: func(c *cli.Context) error {
+					store, err := kv.Create(c.Args().Get(0))
+					if err != nil {
+						return err
+					}
+					defer store.Close()
+					return stats(store, c.Args().Get(1), c.Int("depth"), c.Int("top"), c.String("format"))
+				},
+			},
+			{
+				Name:      "grep",
+				Usage:     "Print the keys where the value matches a pattern or a JSON path filter",
+				ArgsUsage: "<store> [pattern]",
+				Flags: []cli.Flag{
+					&cli.StringFlag{
+						Name:  "prefix",
+						Usage: "Search only the keys with this prefix",
+					},
+					&cli.StringFlag{
+						Name:  "json-path",
+						Usage: "Match JSON values where the dot separated path has the value (path=value) or exists (path)",
+					},
+					&cli.IntFlag{
+						Name:  "workers",
+						Value: 4,
+						Usage: "Number of goroutines reading and matching the values",
+					},
+					&cli.IntFlag{
+						Name:  "context",
+						Value: 30,
+						Usage: "Number of characters to show around the matches",
+					},
+					&cli.BoolFlag{
+						Name:    "ignore-case",
+						Aliases: []string{"i"},
+						Usage:   "Case insensitive matching",
+					},
+					&cli.BoolFlag{
+						Name:    "keys-only",
+						Aliases: []string{"l"},
+						Usage:   "Print only the matching keys",
+					},
+				},
+				Action: func(c *cli.Context) error {
+					store, err := kv.Create(c.Args().Get(0))
+					if err != nil {
+						return err
+					}
+					defer store.Close()
+					return grep(store, c.Args().Get(1), grepOptions{
+						Prefix:     c.String("prefix"),
+						JsonPath:   c.String("json-path"),
+						Workers:    c.Int("workers"),
+						Context:    c.Int("context"),
+						IgnoreCase: c.Bool("ignore-case"),
+						KeysOnly:   c.Bool("keys-only"),
+					}, os.Stdout)
+				},
+			},
+			{
+				Name:      "checkout",
+				Usage:     "Write the keys of a kv store to a directory tree to edit them with the standard tools",
+				ArgsUsage: "<store> <dir>",
+				Flags: []cli.Flag{
+					&cli.StringFlag{
+						Name:  "prefix",
+						Usage: "Check out only the keys with this prefix",
+					},
+					&cli.BoolFlag{
+						Name:  "force",
+						Usage: "Check out to a non-empty directory",
+					},
+				},
+				Action: func(c *cli.Context) error {
+					store, err := kv.Create(c.Args().Get(0))
+					if err != nil {
+						return err
+					}
+					defer store.Close()
+					return checkout(store, c.Args().Get(0), c.Args().Get(1), c.String("prefix"), c.Bool("force"), os.Stdout)
+				},
+			},
+			{
+				Name:      "checkin",
+				Usage:     "Write back the files of a checked out directory which are modified since the checkout",
+				ArgsUsage: "<dir> [store]",
+				Flags: []cli.Flag{
+					&cli.BoolFlag{
+						Name:  "delete",
+						Usage: "Delete the keys from the store which are removed from the directory",
+					},
+					&cli.BoolFlag{
+						Name:  "dry-run",
+						Usage: "Only print the changes",
+					},
+				},
+				Action: func(c *cli.Context) error {
+					dir := c.Args().Get(0)
+					storeUrl := c.Args().Get(1)
+					if storeUrl == "" {
+						state, err := readCheckoutState(dir)
+						if err != nil {
+							return err
+						}
+						storeUrl = state.Store
+					}
+					store, err := kv.Create(storeUrl)
+					if err != nil {
+						return err
+					}
+					defer store.Close()
+					return checkin(dir, store, c.Bool("delete"), c.Bool("dry-run"), os.Stdout)
+				},
+			},
+			{
+				Name:      "shell",
+				Usage:     "Start an interactive session on a kv store",
+				ArgsUsage: "<store>",
+				Action: func(c *cli.Context) error {
+					store, err := kv.Create(c.Args().Get(0))
+					if err != nil {
+						return err
+					}
+					defer store.Close()
+					return runShell(store, os.Stdin, os.Stdout)
 				},
 			},
 			{
@@ -46,15 +441,185 @@ func main() {
 				},
 			},
 			{
-				Name:  "inserts",
-				Usage: "Stress test to do as much as insert as possible",
+				Name:      "query",
+				Usage:     "Filter and project JSON values of an sql: store",
+				ArgsUsage: "<store> [sql expression]",
+				Flags: []cli.Flag{
+					&cli.StringFlag{
+						Name:  "prefix",
+						Usage: "Select values under this prefix (used with --path)",
+					},
+					&cli.StringSliceFlag{
+						Name:  "path",
+						Usage: "JSON path to select from the values (eg. fields.status.name)",
+					},
+					&cli.StringFlag{
+						Name:  "format",
+						Value: "jsonl",
+						Usage: "Output format (jsonl or csv)",
+					},
+				},
+				Action: func(c *cli.Context) error {
+					store, err := kv.Create(c.Args().Get(0))
+					if err != nil {
+						return err
+					}
+					defer store.Close()
+					return query(store, c.Args().Get(1), c.String("prefix"), c.StringSlice("path"), c.String("format"))
+				},
+			},
+			{
+				Name:      "export",
+				Usage:     "Export all keys of a kv store to a tar.gz archive",
+				ArgsUsage: "<store> <archive or ->",
+				Action: func(c *cli.Context) error {
+					store, err := kv.Create(c.Args().Get(0))
+					if err != nil {
+						return err
+					}
+					defer store.Close()
+					return export(store, c.Args().Get(1))
+				},
+			},
+			{
+				Name:      "import",
+				Usage:     "Import keys from a tar.gz archive created by export",
+				ArgsUsage: "<archive or -> <store>",
+				Flags: []cli.Flag{
+					&cli.BoolFlag{
+						Name:  "verify-only",
+						Usage: "Only check the integrity of the archive",
+					},
+				},
+				Action: func(c *cli.Context) error {
+					if c.Bool("verify-only") {
+						return importArchive(c.Args().Get(0), nil)
+					}
+					store, err := kv.Create(c.Args().Get(1))
+					if err != nil {
+						return err
+					}
+					defer store.Close()
+					return importArchive(c.Args().Get(0), store)
+				},
+			},
+			{
+				Name:      "dump",
+				Usage:     "Write the keys and values of a kv store to the standard output",
+				ArgsUsage: "<store>",
+				Flags: []cli.Flag{
+					&cli.StringFlag{
+						Name:  "format",
+						Value: "jsonl",
+						Usage: "Output format (jsonl)",
+					},
+					&cli.StringSliceFlag{
+						Name:  "prefix",
+						Usage: "Dump only the keys with this prefix",
+					},
+					&cli.BoolFlag{
+						Name:  "exact",
+						Usage: "Keep the formatting of the JSON values (formatted values are base64 encoded)",
+					},
+				},
+				Action: func(c *cli.Context) error {
+					store, err := kv.Create(c.Args().Get(0))
+					if err != nil {
+						return err
+					}
+					defer store.Close()
+					return dump(store, c.String("format"), c.Bool("exact"), c.StringSlice("prefix"))
+				},
+			},
+			{
+				Name:      "load",
+				Usage:     "Store JSON Lines records (as written by dump) from the standard input",
+				ArgsUsage: "<store>",
+				Flags: []cli.Flag{
+					&cli.StringSliceFlag{
+						Name:  "prefix",
+						Usage: "Load only the keys with this prefix",
+					},
+				},
 				Action: func(c *cli.Context) error {
 					store, err := kv.Create(c.Args().Get(0))
 					if err != nil {
 						return err
 					}
 					defer store.Close()
-					return inserts(store)
+					return load(store, c.StringSlice("prefix"))
+				},
+			},
+			{
+				Name:      "bench",
+				Usage:     "Benchmark a kv store with configurable workloads",
+				ArgsUsage: "<store>",
+				Flags: []cli.Flag{
+					&cli.StringFlag{
+						Name:  "workload",
+						Value: "seqput",
+						Usage: "Workload to execute (seqput, randput, get, list, iterate or mixed)",
+					},
+					&cli.IntFlag{
+						Name:  "operations",
+						Value: 100000,
+						Usage: "Number of the operations to execute",
+					},
+					&cli.IntFlag{
+						Name:  "keys",
+						Usage: "Size of the key space used by random and read workloads (default: number of operations)",
+					},
+					&cli.IntFlag{
+						Name:  "concurrency",
+						Value: 1,
+						Usage: "Number of parallel workers",
+					},
+					&cli.IntFlag{
+						Name:  "value-size",
+						Value: 1024,
+						Usage: "Size of the written values",
+					},
+					&cli.IntFlag{
+						Name:  "value-size-max",
+						Usage: "If greater than value-size, value sizes are uniformly distributed between the two",
+					},
+					&cli.Float64Flag{
+						Name:  "read-ratio",
+						Value: 0.5,
+						Usage: "Ratio of the read operations in the mixed workload",
+					},
+					&cli.StringFlag{
+						Name:  "cpuprofile",
+						Usage: "Write CPU profile of the benchmark to this file",
+					},
+					&cli.StringFlag{
+						Name:  "memprofile",
+						Usage: "Write heap profile after the benchmark to this file",
+					},
+					&cli.StringFlag{
+						Name:  "format",
+						Value: "text",
+						Usage: "Output format (text or json)",
+					},
+				},
+				Action: func(c *cli.Context) error {
+					store, err := kv.Create(c.Args().Get(0))
+					if err != nil {
+						return err
+					}
+					defer store.Close()
+					return bench(store, benchOptions{
+						Workload:     c.String("workload"),
+						Operations:   c.Int("operations"),
+						Keys:         c.Int("keys"),
+						Concurrency:  c.Int("concurrency"),
+						ValueSize:    c.Int("value-size"),
+						ValueSizeMax: c.Int("value-size-max"),
+						ReadRatio:    c.Float64("read-ratio"),
+						CpuProfile:   c.String("cpuprofile"),
+						MemProfile:   c.String("memprofile"),
+						Format:       c.String("format"),
+					})
 				},
 			},
 		},
@@ -62,59 +627,11 @@ func main() {
 
 	err := app.Run(os.Args)
 	if err != nil {
-		panic(err)
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(exitError)
 	}
 }
 
-func inserts(store kv.KV) error {
-	buffer := make([]byte, 1204)
-	p := util.CreateProgress()
-	defer p.End()
-	for j := 0; j < 1000; j++ {
-		for i := 0; i < 1000; i++ {
-			_, err := rand.Read(buffer)
-			if err != nil {
-				return err
-			}
-			err = store.Put("key"+strconv.Itoa(j)+"/"+strconv.Itoa(i), buffer)
-			if err != nil {
-				return err
-			}
-			p.Increment()
-		}
-	}
-
-	f, err := os.Create("/tmp/memory.pprof")
-	if err != nil {
-		return err
-	}
-	defer f.Close() // error handling omitted for example
-	runtime.GC()    // get up-to-date statistics
-	if err := pprof.WriteHeapProfile(f); err != nil {
-		return err
-	}
-
-	return nil
-}
-
-func copy(from kv.KV, to kv.KV) error {
-	p := util.CreateProgress()
-	err := from.IterateAll(func(key string) error {
-		value, err := from.Get(key)
-		if err != nil {
-			return err
-		}
-		err = to.Put(key, value)
-		if err != nil {
-			return err
-		}
-		p.Increment()
-		return nil
-	})
-	p.End()
-	return err
-}
-
 func count(store kv.KV) error {
 	counter := 0
 	p := util.CreateProgress()
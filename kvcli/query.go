@@ -0,0 +1,84 @@
+package main
+
+import (
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"github.com/elek/go-utils/kv"
+	"github.com/pkg/errors"
+	"io"
+	"os"
+)
+
+func query(store kv.KV, expression string, prefix string, paths []string, format string) error {
+	sqlite, ok := store.(*kv.SqliteKV)
+	if !ok {
+		return errors.New("Query is supported only by sql: stores")
+	}
+	output, err := createRowWriter(os.Stdout, format)
+	if err != nil {
+		return err
+	}
+	if expression != "" {
+		err = sqlite.Query(expression, output.write)
+	} else if len(paths) > 0 {
+		err = sqlite.Select(prefix, paths, output.write)
+	} else {
+		return errors.New("Either an SQL expression or at least one --path should be defined")
+	}
+	if err != nil {
+		return err
+	}
+	return output.flush()
+}
+
+type rowWriter struct {
+	write kv.RowAction
+	flush func() error
+}
+
+func createRowWriter(out io.Writer, format string) (rowWriter, error) {
+	switch format {
+	case "jsonl", "":
+		encoder := json.NewEncoder(out)
+		return rowWriter{
+			write: func(columns []string, values []interface{}) error {
+				row := make(map[string]interface{})
+				for i, column := range columns {
+					row[column] = values[i]
+				}
+				return encoder.Encode(row)
+			},
+			flush: func() error {
+				return nil
+			},
+		}, nil
+	case "csv":
+		writer := csv.NewWriter(out)
+		headerWritten := false
+		return rowWriter{
+			write: func(columns []string, values []interface{}) error {
+				if !headerWritten {
+					headerWritten = true
+					err := writer.Write(columns)
+					if err != nil {
+						return err
+					}
+				}
+				record := make([]string, len(values))
+				for i, value := range values {
+					if value != nil {
+						record[i] = fmt.Sprintf("%v", value)
+					}
+				}
+				return writer.Write(record)
+			},
+			flush: func() error {
+				writer.Flush()
+				return writer.Error()
+			},
+		}, nil
+	default:
+		return rowWriter{}, errors.New("Unsupported output format " + format)
+	}
+}
@@ -0,0 +1,219 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	gojson "encoding/json"
+	"fmt"
+	"github.com/elek/go-utils/kv"
+	"github.com/pkg/errors"
+	"io"
+	"io/ioutil"
+	"os"
+	"path"
+	"strconv"
+	"strings"
+)
+
+const shellHelp = `Commands:
+  cd <prefix>          change the current prefix (.. and / are supported)
+  pwd                  print the current prefix
+  ls [-r] [prefix]     list keys (-r: all keys of the sub-prefixes)
+  get <key>            print a value (JSON values are pretty printed)
+  put <key> <value>    store a value
+  rm <key>             delete a key
+  find <pattern>       find keys under the current prefix (glob pattern or substring)
+  history              print the command history
+  !<n>                 execute the n-th command of the history
+  help                 print this help
+  exit                 leave the shell`
+
+type shell struct {
+	store       kv.KV
+	cwd         string
+	history     []string
+	historyFile string
+	out         io.Writer
+}
+
+func runShell(store kv.KV, in io.Reader, out io.Writer) error {
+	s := &shell{
+		store:   store,
+		out:     out,
+		history: make([]string, 0),
+	}
+	if home, err := os.UserHomeDir(); err == nil {
+		s.historyFile = path.Join(home, ".kvcli_history")
+		s.loadHistory()
+	}
+	scanner := bufio.NewScanner(in)
+	for {
+		fmt.Fprintf(out, "kv:/%s> ", s.cwd)
+		if !scanner.Scan() {
+			fmt.Fprintln(out)
+			return scanner.Err()
+		}
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" {
+			continue
+		}
+		if strings.HasPrefix(line, "!") {
+			index, err := strconv.Atoi(line[1:])
+			if err != nil || index < 1 || index > len(s.history) {
+				fmt.Fprintln(out, "No such history entry: "+line)
+				continue
+			}
+			line = s.history[index-1]
+			fmt.Fprintln(out, line)
+		}
+		s.addHistory(line)
+		if line == "exit" || line == "quit" {
+			return nil
+		}
+		err := s.execute(line)
+		if err != nil {
+			fmt.Fprintln(out, "Error: "+err.Error())
+		}
+	}
+}
+
+func (s *shell) loadHistory() {
+	content, err := ioutil.ReadFile(s.historyFile)
+	if err != nil {
+		return
+	}
+	for _, line := range strings.Split(string(content), "\n") {
+		if line != "" {
+			s.history = append(s.history, line)
+		}
+	}
+}
+
+func (s *shell) addHistory(line string) {
+	s.history = append(s.history, line)
+	if s.historyFile == "" {
+		return
+	}
+	f, err := os.OpenFile(s.historyFile, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0600)
+	if err != nil {
+		return
+	}
+	defer f.Close()
+	_, _ = f.WriteString(line + "\n")
+}
+
+//resolve returns the full key of a (relative or absolute) key
+func (s *shell) resolve(key string) string {
+	if !strings.HasPrefix(key, "/") {
+		key = path.Join("/", s.cwd, key)
+	}
+	return strings.TrimPrefix(path.Clean(key), "/")
+}
+
+func (s *shell) execute(line string) error {
+	fields := strings.Fields(line)
+	command, args := fields[0], fields[1:]
+	switch command {
+	case "help":
+		fmt.Fprintln(s.out, shellHelp)
+	case "pwd":
+		fmt.Fprintln(s.out, "/"+s.cwd)
+	case "cd":
+		if len(args) == 0 {
+			s.cwd = ""
+		} else {
+			s.cwd = s.resolve(args[0])
+		}
+	case "ls":
+		recursive := len(args) > 0 && args[0] == "-r"
+		if recursive {
+			args = args[1:]
+		}
+		prefix := s.cwd
+		if len(args) > 0 {
+			prefix = s.resolve(args[0])
+		}
+		if recursive {
+			return s.store.IterateSubTree(prefix, func(key string) error {
+				fmt.Fprintln(s.out, key)
+				return nil
+			})
+		}
+		keys, err := s.store.List(prefix)
+		if err != nil {
+			return err
+		}
+		for _, key := range keys {
+			fmt.Fprintln(s.out, key)
+		}
+	case "get":
+		if len(args) != 1 {
+			return errors.New("Usage: get <key>")
+		}
+		key := s.resolve(args[0])
+		if !s.store.Contains(key) {
+			return errors.New("No such key: " + key)
+		}
+		value, err := s.store.Get(key)
+		if err != nil {
+			return err
+		}
+		pretty := bytes.Buffer{}
+		if gojson.Indent(&pretty, value, "", "  ") == nil {
+			value = pretty.Bytes()
+		}
+		fmt.Fprintln(s.out, string(value))
+	case "put":
+		if len(args) < 2 {
+			return errors.New("Usage: put <key> <value>")
+		}
+		value := strings.TrimSpace(strings.TrimPrefix(strings.TrimSpace(line[len(command):]), args[0]))
+		return s.store.Put(s.resolve(args[0]), []byte(value))
+	case "rm":
+		if len(args) != 1 {
+			return errors.New("Usage: rm <key>")
+		}
+		key := s.resolve(args[0])
+		if !s.store.Contains(key) {
+			return errors.New("No such key: " + key)
+		}
+		return s.store.Delete(key)
+	case "find":
+		if len(args) != 1 {
+			return errors.New("Usage: find <pattern>")
+		}
+		return s.find(args[0])
+	case "history":
+		for i, entry := range s.history {
+			fmt.Fprintf(s.out, "%5d  %s\n", i+1, entry)
+		}
+	default:
+		return errors.New("Unknown command " + command + " (try help)")
+	}
+	return nil
+}
+
+//find prints the keys where the last element or the key (relative to the current prefix) matches the pattern
+func (s *shell) find(pattern string) error {
+	glob := strings.ContainsAny(pattern, "*?[")
+	if glob {
+		if _, err := path.Match(pattern, ""); err != nil {
+			return err
+		}
+	}
+	return s.store.IterateSubTree(s.cwd, func(key string) error {
+		relative := strings.TrimPrefix(strings.TrimPrefix(key, s.cwd), "/")
+		matched := false
+		if glob {
+			matchBase, _ := path.Match(pattern, path.Base(key))
+			matchRelative, _ := path.Match(pattern, relative)
+			matched = matchBase || matchRelative
+		} else {
+			matched = strings.Contains(relative, pattern)
+		}
+		if matched {
+			fmt.Fprintln(s.out, key)
+		}
+		return nil
+	})
+}
@@ -0,0 +1,91 @@
+package main
+
+import (
+	"bytes"
+	"github.com/elek/go-utils/kv"
+	"github.com/stretchr/testify/assert"
+	"io/ioutil"
+	"os"
+	"strings"
+	"testing"
+)
+
+func TestShell(t *testing.T) {
+	_ = os.RemoveAll("/tmp/kvclitest")
+	assert.Nil(t, os.MkdirAll("/tmp/kvclitest", 0755))
+	home := os.Getenv("HOME")
+	_ = os.Setenv("HOME", "/tmp/kvclitest")
+	defer os.Setenv("HOME", home)
+
+	tests := []struct {
+		name     string
+		input    string
+		contains []string
+		missing  []string
+	}{
+		{
+			name:     "ls",
+			input:    "ls\nls issues\nls -r issues",
+			contains: []string{"issues\n", "issues/HDDS-1\n", "issues/sub/HDDS-2\n"},
+		},
+		{
+			name:     "cd",
+			input:    "cd issues/sub\npwd\ncd ..\npwd\ncd /\npwd",
+			contains: []string{"/issues/sub\n", "/issues\n", "kv:/> /\n"},
+		},
+		{
+			name:     "get",
+			input:    "cd issues\nget HDDS-1\nget missing",
+			contains: []string{"{\n  \"id\": 1\n}\n", "Error: No such key: issues/missing"},
+		},
+		{
+			name:     "put and rm",
+			input:    "put new/key some value\nget new/key\nrm new/key\nget new/key",
+			contains: []string{"some value\n", "Error: No such key: new/key"},
+		},
+		{
+			name:     "find",
+			input:    "find HDDS-*\nfind sub",
+			contains: []string{"issues/HDDS-1\n", "issues/sub/HDDS-2\n"},
+			missing:  []string{"readme\n"},
+		},
+		{
+			name:     "history",
+			input:    "pwd\n!1\n!99\nhistory",
+			contains: []string{"kv:/> /\n", "No such history entry: !99", "    1  pwd\n    2  pwd\n"},
+		},
+		{
+			name:    "exit",
+			input:   "exit\nhelp",
+			missing: []string{"Commands:"},
+		},
+		{
+			name:     "unknown command",
+			input:    "frobnicate",
+			contains: []string{"Error: Unknown command frobnicate"},
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			_ = os.Remove("/tmp/kvclitest/.kvcli_history")
+			store := kv.CreateMemoryKV()
+			assert.Nil(t, store.Put("issues/HDDS-1", []byte("{\"id\":1}")))
+			assert.Nil(t, store.Put("issues/sub/HDDS-2", []byte("value")))
+			assert.Nil(t, store.Put("readme", []byte("value")))
+
+			out := bytes.Buffer{}
+			assert.Nil(t, runShell(store, strings.NewReader(test.input), &out))
+			for _, expected := range test.contains {
+				assert.Contains(t, out.String(), expected)
+			}
+			for _, unexpected := range test.missing {
+				assert.NotContains(t, out.String(), unexpected)
+			}
+		})
+	}
+
+	//history is saved
+	content, err := ioutil.ReadFile("/tmp/kvclitest/.kvcli_history")
+	assert.Nil(t, err)
+	assert.Equal(t, "frobnicate\n", string(content))
+}
@@ -0,0 +1,175 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"github.com/elek/go-utils/kv"
+	"github.com/pkg/errors"
+	"os"
+	"sort"
+	"strings"
+	"text/tabwriter"
+)
+
+type prefixStats struct {
+	Prefix   string         `json:"prefix"`
+	Keys     int            `json:"keys"`
+	Bytes    int64          `json:"bytes"`
+	Children []*prefixStats `json:"children,omitempty"`
+	children map[string]*prefixStats
+}
+
+type keySize struct {
+	Key   string `json:"key"`
+	Bytes int64  `json:"bytes"`
+}
+
+type storeStats struct {
+	Keys     int            `json:"keys"`
+	Bytes    int64          `json:"bytes"`
+	Prefixes []*prefixStats `json:"prefixes"`
+	Largest  []keySize      `json:"largest"`
+}
+
+//child returns the node of the sub-prefix, created if it doesn't exist yet
+func (p *prefixStats) child(name string) *prefixStats {
+	if p.children == nil {
+		p.children = make(map[string]*prefixStats)
+	}
+	child, found := p.children[name]
+	if !found {
+		child = &prefixStats{Prefix: name}
+		p.children[name] = child
+	}
+	return child
+}
+
+//sortChildren converts the child map to a list, ordered by size
+func (p *prefixStats) sortChildren() {
+	for _, child := range p.children {
+		child.sortChildren()
+		p.Children = append(p.Children, child)
+	}
+	sort.Slice(p.Children, func(i, j int) bool {
+		if p.Children[i].Bytes == p.Children[j].Bytes {
+			return p.Children[i].Prefix < p.Children[j].Prefix
+		}
+		return p.Children[i].Bytes > p.Children[j].Bytes
+	})
+}
+
+//collectStats walks the prefixes under the prefix and reads the values of each prefix together with IterateValues. The
+//prefix tree is reported up to depth levels below the prefix.
+func collectStats(store kv.KV, prefix string, depth int, top int) (storeStats, error) {
+	root := &prefixStats{}
+	result := storeStats{Largest: make([]keySize, 0)}
+	//parents are the reported nodes of the prefix, starting with the top level one
+	var walk func(prefix string, parents []*prefixStats) error
+	walk = func(prefix string, parents []*prefixStats) error {
+		keys := make(map[string]bool)
+		err := store.IterateValues(prefix, func(key string, value []byte) error {
+			keys[key] = true
+			size := int64(len(value))
+			result.Keys++
+			result.Bytes += size
+			for _, parent := range parents {
+				parent.Keys++
+				parent.Bytes += size
+			}
+			if top > 0 && (len(result.Largest) < top || result.Largest[len(result.Largest)-1].Bytes < size) {
+				result.Largest = append(result.Largest, keySize{Key: key, Bytes: size})
+				sort.SliceStable(result.Largest, func(i, j int) bool {
+					return result.Largest[i].Bytes > result.Largest[j].Bytes
+				})
+				if len(result.Largest) > top {
+					result.Largest = result.Largest[:top]
+				}
+			}
+			return nil
+		})
+		if err != nil {
+			return errors.Wrap(err, "Couldn't read the values of "+prefix)
+		}
+		children, err := store.List(prefix)
+		if err != nil {
+			return err
+		}
+		for _, child := range children {
+			if keys[child] {
+				continue
+			}
+			childParents := parents
+			if len(parents) < depth {
+				node := root
+				if len(parents) > 0 {
+					node = parents[len(parents)-1]
+				}
+				//copy, to keep the slice of the siblings unchanged
+				childParents = append(parents[:len(parents):len(parents)], node.child(child))
+			}
+			err = walk(child, childParents)
+			if err != nil {
+				return err
+			}
+		}
+		return nil
+	}
+	err := walk(strings.TrimSuffix(prefix, "/"), nil)
+	root.sortChildren()
+	result.Prefixes = root.Children
+	return result, err
+}
+
+func stats(store kv.KV, prefix string, depth int, top int, format string) error {
+	result, err := collectStats(store, prefix, depth, top)
+	if err != nil {
+		return err
+	}
+	switch format {
+	case "json":
+		encoder := json.NewEncoder(os.Stdout)
+		encoder.SetIndent("", "  ")
+		return encoder.Encode(result)
+	case "text":
+		fmt.Printf("Total keys: %d, total size: %s\n\n", result.Keys, humanBytes(result.Bytes))
+		w := tabwriter.NewWriter(os.Stdout, 0, 4, 2, ' ', tabwriter.AlignRight)
+		fmt.Fprintln(w, "KEYS\tSIZE\t\tPREFIX")
+		printPrefixStats(w, result.Prefixes, 0)
+		err = w.Flush()
+		if err != nil {
+			return err
+		}
+		if len(result.Largest) > 0 {
+			fmt.Println("\nLargest keys:")
+			w = tabwriter.NewWriter(os.Stdout, 0, 4, 2, ' ', tabwriter.AlignRight)
+			for _, key := range result.Largest {
+				fmt.Fprintf(w, "%s\t\t%s\n", humanBytes(key.Bytes), key.Key)
+			}
+			return w.Flush()
+		}
+		return nil
+	default:
+		return errors.New("Unsupported output format " + format)
+	}
+}
+
+func printPrefixStats(w *tabwriter.Writer, prefixes []*prefixStats, level int) {
+	for _, prefix := range prefixes {
+		fmt.Fprintf(w, "%d\t%s\t\t%s%s\n", prefix.Keys, humanBytes(prefix.Bytes), strings.Repeat("  ", level), prefix.Prefix)
+		printPrefixStats(w, prefix.Children, level+1)
+	}
+}
+
+func humanBytes(size int64) string {
+	units := []string{"B", "KiB", "MiB", "GiB", "TiB"}
+	value := float64(size)
+	unit := 0
+	for value >= 1024 && unit < len(units)-1 {
+		value /= 1024
+		unit++
+	}
+	if unit == 0 {
+		return fmt.Sprintf("%d %s", size, units[unit])
+	}
+	return fmt.Sprintf("%.1f %s", value, units[unit])
+}
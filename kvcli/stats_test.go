@@ -0,0 +1,109 @@
+package main
+
+import (
+	"github.com/elek/go-utils/kv"
+	"github.com/pkg/errors"
+	"github.com/stretchr/testify/assert"
+	"os"
+	"testing"
+)
+
+func TestCollectStats(t *testing.T) {
+	store := kv.CreateMemoryKV()
+	for key, value := range map[string]string{
+		"issues/HDDS/1":  "12345",
+		"issues/HDDS/2":  "123",
+		"issues/RATIS/1": "1",
+		"pulls/1":        "1234567890",
+		"readme":         "12",
+	} {
+		assert.Nil(t, store.Put(key, []byte(value)))
+	}
+
+	result, err := collectStats(store, "", 2, 2)
+	assert.Nil(t, err)
+	assert.Equal(t, 5, result.Keys)
+	assert.Equal(t, int64(21), result.Bytes)
+	assert.Equal(t, []keySize{{Key: "pulls/1", Bytes: 10}, {Key: "issues/HDDS/1", Bytes: 5}}, result.Largest)
+
+	//ordered by size
+	assert.Equal(t, 2, len(result.Prefixes))
+	assert.Equal(t, "pulls", result.Prefixes[0].Prefix)
+	issues := result.Prefixes[1]
+	assert.Equal(t, "issues", issues.Prefix)
+	assert.Equal(t, 3, issues.Keys)
+	assert.Equal(t, int64(9), issues.Bytes)
+	assert.Equal(t, "issues/HDDS", issues.Children[0].Prefix)
+	assert.Equal(t, 2, issues.Children[0].Keys)
+	assert.Equal(t, "issues/RATIS", issues.Children[1].Prefix)
+
+	//depth is counted from the prefix
+	result, err = collectStats(store, "issues", 1, 0)
+	assert.Nil(t, err)
+	assert.Equal(t, 3, result.Keys)
+	assert.Equal(t, 2, len(result.Prefixes))
+	assert.Equal(t, "issues/HDDS", result.Prefixes[0].Prefix)
+	assert.Equal(t, 2, result.Prefixes[0].Keys)
+	assert.Equal(t, int64(8), result.Prefixes[0].Bytes)
+	assert.Empty(t, result.Prefixes[0].Children)
+	assert.Equal(t, "issues/RATIS", result.Prefixes[1].Prefix)
+	assert.Empty(t, result.Largest)
+
+	result, err = collectStats(store, "issues/", 0, 1)
+	assert.Nil(t, err)
+	assert.Equal(t, 3, result.Keys)
+	assert.Empty(t, result.Prefixes)
+	assert.Equal(t, []keySize{{Key: "issues/HDDS/1", Bytes: 5}}, result.Largest)
+}
+
+//noGetKV fails the single reads, stats should read the values together
+type noGetKV struct {
+	kv.KV
+}
+
+func (n noGetKV) Get(key string) ([]byte, error) {
+	return nil, errors.New("Unexpected read of " + key)
+}
+
+func TestCollectStatsStores(t *testing.T) {
+	_ = os.RemoveAll("/tmp/kvclitest")
+	_ = os.MkdirAll("/tmp/kvclitest", 0755)
+	sqlite, err := kv.CreateSqliteKV("/tmp/kvclitest/stats.db")
+	assert.Nil(t, err)
+	defer sqlite.Close()
+	stores := []kv.KV{
+		kv.CreateMemoryKV(),
+		&kv.DirKV{Path: "/tmp/kvclitest/stats"},
+		sqlite,
+	}
+	for _, store := range stores {
+		assert.Nil(t, store.Put("issues/HDDS/1", []byte("12345")))
+		assert.Nil(t, store.Put("issues/RATIS/1", []byte("1")))
+		assert.Nil(t, store.Put("readme", []byte("12")))
+
+		result, err := collectStats(noGetKV{store}, "", 2, 1)
+		assert.Nil(t, err)
+		assert.Equal(t, 3, result.Keys)
+		assert.Equal(t, int64(8), result.Bytes)
+		assert.Equal(t, 1, len(result.Prefixes))
+		assert.Equal(t, 2, len(result.Prefixes[0].Children))
+	}
+}
+
+func TestHumanBytes(t *testing.T) {
+	tests := []struct {
+		size     int64
+		expected string
+	}{
+		{0, "0 B"},
+		{1023, "1023 B"},
+		{1024, "1.0 KiB"},
+		{1536, "1.5 KiB"},
+		{5 * 1024 * 1024, "5.0 MiB"},
+		{3 << 40, "3.0 TiB"},
+		{2048 << 40, "2048.0 TiB"},
+	}
+	for _, test := range tests {
+		assert.Equal(t, test.expected, humanBytes(test.size))
+	}
+}
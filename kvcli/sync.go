@@ -0,0 +1,27 @@
+package main
+
+import (
+	"fmt"
+	"github.com/elek/go-utils/kv"
+	"os"
+)
+
+var syncMarkers = map[kv.SyncAction]string{
+	kv.Added:   "+",
+	kv.Updated: "~",
+	kv.Deleted: "-",
+}
+
+func syncStores(from kv.KV, to kv.KV, options kv.SyncOptions) error {
+	if options.DryRun {
+		options.OnChange = func(action kv.SyncAction, key string) {
+			fmt.Println(syncMarkers[action] + " " + key)
+		}
+	}
+	result, err := kv.Sync(from, to, options)
+	if err != nil {
+		return err
+	}
+	fmt.Fprintf(os.Stderr, "Added: %d, updated: %d, deleted: %d, unchanged: %d\n", result.Added, result.Updated, result.Deleted, result.Unchanged)
+	return nil
+}
@@ -2,13 +2,21 @@ package util
 
 import (
 	"github.com/rs/zerolog/log"
+	"strings"
+	"sync"
 	"time"
 )
 
+//width of the progress bar (in characters) when the total is known
+const progressBarWidth = 30
+
+//Progress logs the speed of a long-running iteration. It's safe to use it from multiple goroutines.
 type Progress struct {
 	start   time.Time
 	lastLog time.Time
 	counter int
+	total   int
+	lock    sync.Mutex
 }
 
 func CreateProgress() *Progress {
@@ -19,15 +27,41 @@ func CreateProgress() *Progress {
 		counter: 0,
 	}
 }
+
+//CreateProgressWithTotal creates a Progress which also logs the completed percentage and the estimated remaining time
+func CreateProgressWithTotal(total int) *Progress {
+	p := CreateProgress()
+	p.total = total
+	return p
+}
+
 func (p *Progress) Increment() {
+	p.lock.Lock()
+	defer p.lock.Unlock()
 	p.counter++
 	if time.Since(p.lastLog).Seconds() > 5 {
 		p.lastLog = time.Now()
-		log.Info().Msgf("Processed %d iteration with the average speed: %f/sec", p.counter, float64(p.counter)/time.Since(p.start).Seconds())
+		speed := float64(p.counter) / time.Since(p.start).Seconds()
+		if p.total > 0 {
+			eta := time.Duration(float64(p.total-p.counter) / speed * float64(time.Second)).Round(time.Second)
+			log.Info().Msgf("%s Processed %d/%d iteration with the average speed: %f/sec, ETA: %s", p.bar(), p.counter, p.total, speed, eta)
+		} else {
+			log.Info().Msgf("Processed %d iteration with the average speed: %f/sec", p.counter, speed)
+		}
+	}
+}
+
+func (p *Progress) bar() string {
+	done := progressBarWidth * p.counter / p.total
+	if done > progressBarWidth {
+		done = progressBarWidth
 	}
+	return "[" + strings.Repeat("=", done) + strings.Repeat(" ", progressBarWidth-done) + "]"
 }
 
 func (p *Progress) End() {
+	p.lock.Lock()
+	defer p.lock.Unlock()
 	seconds := time.Since(p.start).Seconds()
 	log.Info().Msgf("Processed %d iteration under %f seconds,  with the average speed: %f/sec", p.counter, seconds, float64(p.counter)/seconds)
 }